@@ -0,0 +1,16 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package analysis
+
+import "github.com/zeebo/errs"
+
+var (
+	// Error wraps all of the errors originating at this package.
+	Error = errs.Class("analysis")
+
+	// NoData wraps the errors for windows that contain no records.
+	NoData = errs.Class("no data")
+
+	// BadRange wraps the errors for windows that do not end after they start.
+	BadRange = errs.Class("bad range")
+)
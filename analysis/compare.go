@@ -0,0 +1,153 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package analysis
+
+import (
+	"context"
+	"math"
+
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/merge"
+)
+
+// DefaultSamples is the number of points used to estimate the statistics
+// when none is specified.
+const DefaultSamples = 1000
+
+// DefaultQuantiles are the quantiles reported when none are specified.
+var DefaultQuantiles = []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99}
+
+// Options controls how distributions are compared.
+type Options struct {
+	// Samples is how many points are used to estimate the Kolmogorov-Smirnov
+	// statistic and the Wasserstein distance. If zero, DefaultSamples is used.
+	Samples int
+
+	// Quantiles are the quantiles to report the values of. They must be
+	// increasing and in [0, 1]. If nil, DefaultQuantiles is used.
+	Quantiles []float64
+}
+
+// QuantileDelta is the value of a quantile in both distributions.
+type QuantileDelta struct {
+	// Quantile is in [0, 1].
+	Quantile float64
+
+	// Baseline and Recent are the values of the quantile.
+	Baseline float64
+	Recent   float64
+
+	// Delta is Recent minus Baseline.
+	Delta float64
+}
+
+// Comparison is the result of comparing a recent distribution against a
+// baseline.
+type Comparison struct {
+	// BaselineCount and RecentCount are the number of observations.
+	BaselineCount int64
+	RecentCount   int64
+
+	// KS is the Kolmogorov-Smirnov statistic: the largest difference between
+	// the CDFs of the distributions. It is in [0, 1].
+	KS float64
+
+	// Wasserstein is the first Wasserstein (earth mover's) distance between
+	// the distributions, in the units of the values.
+	Wasserstein float64
+
+	// Quantiles are the values of the requested quantiles.
+	Quantiles []QuantileDelta
+}
+
+// Compare computes statistics describing how the recent distribution differs
+// from the baseline.
+func Compare(ctx context.Context, baseline, recent dist.Dist, opts Options) (
+	cmp Comparison, err error) {
+
+	if baseline.Len() == 0 || recent.Len() == 0 {
+		return cmp, Error.New("cannot compare an empty distribution")
+	}
+
+	samples := opts.Samples
+	if samples <= 0 {
+		samples = DefaultSamples
+	}
+	quantiles := opts.Quantiles
+	if quantiles == nil {
+		quantiles = DefaultQuantiles
+	}
+	if err := merge.CheckQuantiles(quantiles); err != nil {
+		return cmp, Error.Wrap(err)
+	}
+
+	return Comparison{
+		BaselineCount: baseline.Len(),
+		RecentCount:   recent.Len(),
+		KS:            KolmogorovSmirnov(baseline, recent, samples),
+		Wasserstein:   Wasserstein(baseline, recent, samples),
+		Quantiles:     QuantileDeltas(baseline, recent, quantiles),
+	}, nil
+}
+
+// KolmogorovSmirnov estimates the largest difference between the CDFs of
+// the distributions by evaluating both CDFs at samples evenly spaced
+// quantiles of each distribution, including their minimum and maximum.
+func KolmogorovSmirnov(a, b dist.Dist, samples int) float64 {
+	if samples < 2 {
+		samples = 2
+	}
+
+	ks := 0.0
+	for i := 0; i < samples; i++ {
+		p := float64(i) / float64(samples-1)
+		for _, x := range [2]float64{a.Query(p), b.Query(p)} {
+			if diff := math.Abs(cdf(a, x) - cdf(b, x)); diff > ks {
+				ks = diff
+			}
+		}
+	}
+	return math.Min(ks, 1)
+}
+
+// Wasserstein estimates the first Wasserstein distance between the
+// distributions, which is the area between their quantile functions, using
+// the midpoint rule with samples points.
+func Wasserstein(a, b dist.Dist, samples int) float64 {
+	if samples < 1 {
+		samples = 1
+	}
+
+	sum := 0.0
+	for i := 0; i < samples; i++ {
+		p := (float64(i) + 0.5) / float64(samples)
+		sum += math.Abs(a.Query(p) - b.Query(p))
+	}
+	return sum / float64(samples)
+}
+
+// QuantileDeltas returns the values of the quantiles in both distributions.
+func QuantileDeltas(baseline, recent dist.Dist,
+	quantiles []float64) []QuantileDelta {
+
+	out := make([]QuantileDelta, 0, len(quantiles))
+	for _, q := range quantiles {
+		base, rec := baseline.Query(q), recent.Query(q)
+		out = append(out, QuantileDelta{
+			Quantile: q,
+			Baseline: base,
+			Recent:   rec,
+			Delta:    rec - base,
+		})
+	}
+	return out
+}
+
+// cdf returns the CDF of the distribution at x, using the exact CDF if the
+// distribution provides one.
+func cdf(d dist.Dist, x float64) float64 {
+	if exact, ok := d.(dist.ExactCDFer); ok {
+		return exact.ExactCDF(x)
+	}
+	return d.CDF(x)
+}
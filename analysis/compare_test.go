@@ -0,0 +1,83 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package analysis
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/dist/tdigest"
+)
+
+var ctx = context.Background()
+
+var testParams = tdigest.Params{Compression: 100}
+
+func newTestDist(t *testing.T, lo, hi float64) dist.Dist {
+	d, err := testParams.New()
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		d.Observe(lo + (hi-lo)*float64(i)/999)
+	}
+	return d
+}
+
+func TestCompare(t *testing.T) {
+	near := func(t *testing.T, got, want, eps float64) {
+		t.Helper()
+		assert.That(t, math.Abs(got-want) < eps)
+	}
+
+	t.Run("Same", func(t *testing.T) {
+		a, b := newTestDist(t, 0, 1000), newTestDist(t, 0, 1000)
+		cmp, err := Compare(ctx, a, b, Options{})
+		assert.NoError(t, err)
+
+		near(t, cmp.KS, 0, 1e-3)
+		near(t, cmp.Wasserstein, 0, 1e-3)
+		assert.Equal(t, len(cmp.Quantiles), len(DefaultQuantiles))
+		for _, q := range cmp.Quantiles {
+			near(t, q.Delta, 0, 1e-3)
+		}
+	})
+
+	t.Run("Shifted", func(t *testing.T) {
+		a, b := newTestDist(t, 0, 1000), newTestDist(t, 100, 1100)
+		cmp, err := Compare(ctx, a, b, Options{Quantiles: []float64{.5}})
+		assert.NoError(t, err)
+
+		assert.Equal(t, cmp.BaselineCount, int64(1000))
+		assert.Equal(t, cmp.RecentCount, int64(1000))
+		near(t, cmp.KS, 0.1, 0.01)
+		near(t, cmp.Wasserstein, 100, 1)
+		assert.Equal(t, len(cmp.Quantiles), 1)
+		assert.Equal(t, cmp.Quantiles[0].Quantile, 0.5)
+		near(t, cmp.Quantiles[0].Baseline, 500, 1)
+		near(t, cmp.Quantiles[0].Recent, 600, 1)
+		near(t, cmp.Quantiles[0].Delta, 100, 1)
+	})
+
+	t.Run("Disjoint", func(t *testing.T) {
+		a, b := newTestDist(t, 0, 10), newTestDist(t, 20, 30)
+		cmp, err := Compare(ctx, a, b, Options{})
+		assert.NoError(t, err)
+
+		near(t, cmp.KS, 1, 1e-9)
+		near(t, cmp.Wasserstein, 20, 0.1)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		a := newTestDist(t, 0, 10)
+		empty, err := testParams.New()
+		assert.NoError(t, err)
+
+		_, err = Compare(ctx, a, empty, Options{})
+		assert.Error(t, err)
+
+		_, err = Compare(ctx, a, a, Options{Quantiles: []float64{.5, .1}})
+		assert.Error(t, err)
+	})
+}
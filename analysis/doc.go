@@ -0,0 +1,4 @@
+// Copyright (C) 2018. See AUTHORS.
+
+// package analysis provides statistics for comparing rothko distributions.
+package analysis
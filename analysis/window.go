@@ -0,0 +1,74 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package analysis
+
+import (
+	"context"
+	"math"
+
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/database"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/merge"
+)
+
+// Window merges all of the records for the metric in the time range
+// [start, end) into a single distribution with the given params. Records
+// that start before the range are weighted by how much of them is in it, and
+// records that end after the range are not included.
+func Window(ctx context.Context, source database.Source, metric string,
+	start, end int64, params dist.Params) (dist.Dist, error) {
+
+	if start >= end {
+		return nil, Error.Wrap(BadRange.New("[%d, %d)", start, end))
+	}
+
+	// records that end with the range are in it, but a query only finds the
+	// records that end strictly before the time it is given.
+	query_end := end
+	if query_end < math.MaxInt64 {
+		query_end++
+	}
+
+	var records []data.Record
+	var weights []float64
+
+	err := database.QueryRange(ctx, source, metric, start, query_end, nil,
+		func(ctx context.Context, rec_start, rec_end int64, buf []byte) (
+			bool, error) {
+
+			var rec data.Record
+			if err := rec.Unmarshal(buf); err != nil {
+				return false, Error.Wrap(err)
+			}
+
+			if weight := merge.Overlap(rec, start, end); weight > 0 {
+				records = append(records, rec)
+				weights = append(weights, weight)
+			}
+			return true, nil
+		})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	if len(records) == 0 {
+		return nil, Error.Wrap(NoData.New("%q in [%d, %d)",
+			metric, start, end))
+	}
+
+	rec, err := merge.Merge(ctx, merge.MergeOptions{
+		Params:  params,
+		Records: records,
+		Weights: weights,
+	})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	out, err := load.Load(ctx, rec)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	return out, nil
+}
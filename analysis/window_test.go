@@ -0,0 +1,113 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package analysis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/database"
+)
+
+// testSource is a Source with a single metric, whose records are stored in
+// increasing order by their end.
+type testSource []data.Record
+
+func (t testSource) Query(ctx context.Context, metric string, end int64,
+	buf []byte, cb database.ResultCallback) error {
+
+	for i := len(t) - 1; i >= 0; i-- {
+		if t[i].EndTime >= end {
+			continue
+		}
+		data, err := t[i].Marshal()
+		if err != nil {
+			return err
+		}
+		ok, err := cb(ctx, t[i].StartTime, t[i].EndTime, data)
+		if !ok || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t testSource) QueryLatest(ctx context.Context, metric string,
+	buf []byte) (start, end int64, data []byte, err error) {
+
+	return 0, 0, nil, errors.New("unimplemented")
+}
+
+func (t testSource) Metrics(ctx context.Context,
+	cb func(name string) (bool, error)) error {
+
+	return errors.New("unimplemented")
+}
+
+func newTestRecord(t *testing.T, start, end int64, val float64,
+	n int) data.Record {
+
+	d, err := testParams.New()
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		d.Observe(val)
+	}
+
+	return data.Record{
+		StartTime:    start,
+		EndTime:      end,
+		Observations: int64(n),
+		Distribution: d.Marshal(nil),
+		Kind:         d.Kind(),
+		Merged:       1,
+		Min:          val,
+		Max:          val,
+	}
+}
+
+func TestWindow(t *testing.T) {
+	source := testSource{
+		newTestRecord(t, 0, 10, 1, 100),
+		newTestRecord(t, 10, 20, 2, 100),
+		newTestRecord(t, 20, 30, 3, 100),
+	}
+
+	t.Run("Partial", func(t *testing.T) {
+		d, err := Window(ctx, source, "m", 15, 35, testParams)
+		assert.NoError(t, err)
+		assert.Equal(t, d.Len(), int64(150))
+		assert.Equal(t, d.Query(0), 2.0)
+		assert.Equal(t, d.Query(1), 3.0)
+	})
+
+	t.Run("Excludes", func(t *testing.T) {
+		d, err := Window(ctx, source, "m", 10, 25, testParams)
+		assert.NoError(t, err)
+		assert.Equal(t, d.Len(), int64(100))
+		assert.Equal(t, d.Query(0), 2.0)
+		assert.Equal(t, d.Query(1), 2.0)
+	})
+
+	t.Run("Boundaries", func(t *testing.T) {
+		d, err := Window(ctx, source, "m", 10, 20, testParams)
+		assert.NoError(t, err)
+		assert.Equal(t, d.Len(), int64(100))
+		assert.Equal(t, d.Query(0), 2.0)
+		assert.Equal(t, d.Query(1), 2.0)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := Window(ctx, source, "m", 30, 40, testParams)
+		assert.That(t, NoData.Has(err))
+	})
+
+	t.Run("BadRange", func(t *testing.T) {
+		_, err := Window(ctx, source, "m", 20, 10, testParams)
+		assert.That(t, BadRange.Has(err))
+		_, err = Window(ctx, source, "m", 10, 10, testParams)
+		assert.That(t, BadRange.Has(err))
+	})
+}
@@ -5,6 +5,7 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zeebo/errs"
@@ -16,6 +17,8 @@ var (
 	errMethodNotAllowed = errs.Class("method not allowed")
 	errBadRequest       = errs.Class("bad request")
 	errUnauthorized     = errs.Class("unauthorized")
+	errForbidden        = errs.Class("forbidden")
+	errNotImplemented   = errs.Class("not implemented")
 )
 
 type statusCode struct{}
@@ -25,6 +28,8 @@ func init() {
 	errdata.Set(&errMethodNotAllowed, statusCode{}, http.StatusMethodNotAllowed)
 	errdata.Set(&errBadRequest, statusCode{}, http.StatusBadRequest)
 	errdata.Set(&errUnauthorized, statusCode{}, http.StatusUnauthorized)
+	errdata.Set(&errForbidden, statusCode{}, http.StatusForbidden)
+	errdata.Set(&errNotImplemented, statusCode{}, http.StatusNotImplemented)
 }
 
 func getStatusCode(err error) int {
@@ -56,6 +61,13 @@ func (r *respTracker) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+func getString(x string, def string) string {
+	if x != "" {
+		return x
+	}
+	return def
+}
+
 func getInt64(x string, def int64) int64 {
 	if val, err := strconv.ParseInt(x, 10, 64); err == nil {
 		return val
@@ -83,3 +95,22 @@ func getFloat64(x string, def float64) float64 {
 	}
 	return def
 }
+
+func getBool(x string, def bool) bool {
+	if val, err := strconv.ParseBool(x); err == nil {
+		return val
+	}
+	return def
+}
+
+func getFloat64s(x string) ([]float64, error) {
+	var out []float64
+	for _, part := range strings.Split(x, ",") {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		out = append(out, val)
+	}
+	return out, nil
+}
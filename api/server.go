@@ -15,15 +15,19 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/zeebo/rothko/analysis"
 	"github.com/zeebo/rothko/api/query"
 	"github.com/zeebo/rothko/data"
 	"github.com/zeebo/rothko/data/load"
 	"github.com/zeebo/rothko/database"
-	"github.com/zeebo/rothko/dist/tdigest"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/draw"
 	"github.com/zeebo/rothko/draw/colors"
 	"github.com/zeebo/rothko/draw/graph"
+	"github.com/zeebo/rothko/draw/grid"
 	"github.com/zeebo/rothko/external"
 	"github.com/zeebo/rothko/merge"
+	"github.com/zeebo/rothko/registry"
 	"github.com/zeebo/errs"
 )
 
@@ -123,7 +127,15 @@ func (s *Server) serveHTTP(ctx context.Context, w http.ResponseWriter,
 		}
 	}
 
-	if req.Method != "GET" {
+	// the endpoints that modify metrics have their own methods
+	switch {
+	case req.URL.Path == "/api/metric" && req.Method == "DELETE":
+		return s.serveDelete(ctx, w, req)
+
+	case req.URL.Path == "/api/rename" && req.Method == "POST":
+		return s.serveRename(ctx, w, req)
+
+	case req.Method != "GET":
 		return errMethodNotAllowed.New("%s", req.Method)
 	}
 
@@ -131,6 +143,12 @@ func (s *Server) serveHTTP(ctx context.Context, w http.ResponseWriter,
 	case "/api/render":
 		return s.serveRender(ctx, w, req)
 
+	case "/api/grid":
+		return s.serveGrid(ctx, w, req)
+
+	case "/api/compare":
+		return s.serveCompare(ctx, w, req)
+
 	case "/api/query":
 		return s.serveQuery(ctx, w, req)
 
@@ -146,48 +164,111 @@ func (s *Server) serveHTTP(ctx context.Context, w http.ResponseWriter,
 	}
 }
 
+// manager returns the database as a database.Manager if the request is
+// allowed to modify metrics. Since anyone could otherwise remove all of the
+// data, metrics can only be modified when basic auth is configured.
+func (s *Server) manager(ctx context.Context) (database.Manager, error) {
+	if s.opts.Username == "" {
+		return nil, errForbidden.New("modifying metrics requires basic auth")
+	}
+	manager, ok := s.db.(database.Manager)
+	if !ok {
+		return nil, errNotImplemented.New("database cannot modify metrics")
+	}
+	return manager, nil
+}
+
+// serveDelete deletes all of the data for the metric.
+func (s *Server) serveDelete(ctx context.Context, w http.ResponseWriter,
+	req *http.Request) (err error) {
+
+	manager, err := s.manager(ctx)
+	if err != nil {
+		return err
+	}
+
+	metric := req.FormValue("metric")
+	if metric == "" {
+		return errBadRequest.New("metric required")
+	}
+	if err := manager.Delete(ctx, metric); err != nil {
+		return errs.Wrap(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// serveRename moves all of the data for the from metric to the to metric.
+func (s *Server) serveRename(ctx context.Context, w http.ResponseWriter,
+	req *http.Request) (err error) {
+
+	manager, err := s.manager(ctx)
+	if err != nil {
+		return err
+	}
+
+	from, to := req.FormValue("from"), req.FormValue("to")
+	if from == "" || to == "" {
+		return errBadRequest.New("from and to required")
+	}
+	if err := manager.Rename(ctx, from, to); err != nil {
+		return errs.Wrap(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 // serveRender serves either a png of the graph, or a json encoded set of
 // columns, and the earliest data so that the frontend can draw the graph.
 func (s *Server) serveRender(ctx context.Context, w http.ResponseWriter,
 	req *http.Request) (err error) {
 
-	// get the render parameters
+	// a query can be passed instead of a metric to merge every matching
+	// metric into the same graph.
 	metric := req.FormValue("metric")
+	_query := req.FormValue("query")
+	if metric == "" && _query == "" {
+		return errBadRequest.New("metric or query required")
+	}
+	metrics := []string{metric}
 	if metric == "" {
-		return errBadRequest.New("metric required")
+		metrics, err = s.matchMetrics(ctx, _query,
+			getInt(req.FormValue("limit"), 100))
+		if err != nil {
+			return err
+		}
 	}
 
-	width := getInt(req.FormValue("width"), 1000)
-	height := getInt(req.FormValue("height"), 350)
-	padding := getInt(req.FormValue("padding"), 0)
-	now := getInt64(req.FormValue("now"), time.Now().UnixNano())
-	dur := getDuration(req.FormValue("duration"), 24*time.Hour)
-	samples := getInt(req.FormValue("samples"), 30)
-	compression := getFloat64(req.FormValue("compression"), 5)
-	stop_before := now - dur.Nanoseconds()
+	// a compare metric or offset draws the difference against the compare
+	// metric, or the same metrics shifted by the offset, instead.
+	compare := req.FormValue("compare")
+	compare_offset := getDuration(req.FormValue("compare_offset"), 0)
+	comparing := compare != "" || compare_offset != 0
+	compare_metrics := metrics
+	if compare != "" {
+		compare_metrics = []string{compare}
+	}
+
+	// get the render parameters
+	params, err := getRenderParams(ctx, req, 1000, 350)
+	if err != nil {
+		return err
+	}
+	ctx = database.WithResolution(ctx, params.resolution())
+	stop_before := params.measure.Now - params.measure.Duration.Nanoseconds()
 
 	// set up some state for the query
 	var measured graph.Measured
 	var earliest []byte
-	measure_opts := graph.MeasureOptions{
-		Now:      now,
-		Duration: dur,
-		Width:    width,
-		Height:   height,
-		Padding:  padding,
-	}
-
-	merger := merge.NewMerger(merge.MergerOptions{
-		Samples:  samples,
-		Now:      now,
-		Duration: dur,
-		Params:   tdigest.Params{Compression: compression},
-	})
+	measure_opts := params.measure
+	merger := merge.NewMerger(params.merger)
 	var ok bool
 
 	// run the query
-	err = s.db.Query(ctx, metric, now, nil,
-		func(ctx context.Context, start, end int64, buf []byte) (
+	err = database.MergedQuery(ctx, s.db, metrics, measure_opts.Now,
+		func(ctx context.Context, _ string, start, end int64, buf []byte) (
 			bool, error) {
 
 			// get the record ready
@@ -233,19 +314,41 @@ func (s *Server) serveRender(ctx context.Context, w http.ResponseWriter,
 		return errs.Wrap(err)
 	}
 
+	// grab the columns to compare against if we have any axes to compare
+	// them on.
+	var compare_cols []draw.Column
+	if comparing && measure_opts.Earliest != nil {
+		compare_cols, err = s.compareColumns(ctx, compare_metrics,
+			params.merger, compare_offset, measured.Width)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+	}
+
+	// let the client know if the graph mixes distribution kinds
+	if merger.Converted() {
+		w.Header().Set("X-Rothko-Converted", "true")
+	}
+
 	// if it's json, encode it out
 	if req.Header.Get("Accept") == "application/json" {
 		w.Header().Set("Content-Type", "application/json")
 		type D = map[string]interface{}
 		return errs.Wrap(json.NewEncoder(w).Encode(D{
-			"metric":   metric,
-			"columns":  cols,
-			"earliest": earliest,
-			"now":      now,
-			"duration": dur.Nanoseconds(),
-			"width":    width,
-			"height":   height,
-			"padding":  padding,
+			"metric":          metric,
+			"query":           _query,
+			"metrics":         metrics,
+			"columns":         cols,
+			"earliest":        earliest,
+			"compare":         compare,
+			"compare_offset":  compare_offset.Nanoseconds(),
+			"compare_columns": compare_cols,
+			"now":             measure_opts.Now,
+			"duration":        measure_opts.Duration.Nanoseconds(),
+			"width":           measure_opts.Width,
+			"height":          measure_opts.Height,
+			"padding":         measure_opts.Padding,
+			"converted":       merger.Converted(),
 		}))
 	}
 
@@ -259,10 +362,222 @@ func (s *Server) serveRender(ctx context.Context, w http.ResponseWriter,
 	}
 
 	// draw the graph
-	out := measured.Draw(ctx, graph.DrawOptions{
+	draw_opts := graph.DrawOptions{
 		Canvas:  nil,
 		Columns: cols,
 		Colors:  colors.Viridis,
+	}
+	if comparing {
+		draw_opts.Compare = compare_cols
+		draw_opts.Colors = colors.Diverging
+	}
+	out := measured.Draw(ctx, draw_opts)
+
+	// encode it out as a png
+	w.Header().Set("Content-Type", "image/png")
+	return errs.Wrap(png.Encode(w, out.AsImage()))
+}
+
+// compareColumns merges the columns for the metrics with the options
+// shifted back by the offset, so that they line up with columns merged with
+// the options.
+func (s *Server) compareColumns(ctx context.Context, metrics []string,
+	opts merge.MergerOptions, offset time.Duration, width int) (
+	[]draw.Column, error) {
+
+	opts.Now += offset.Nanoseconds()
+	stop_before := opts.Now - opts.Duration.Nanoseconds()
+
+	merger := merge.NewMerger(opts)
+	merger.SetWidth(width)
+
+	err := database.MergedQuery(ctx, s.db, metrics, opts.Now,
+		func(ctx context.Context, _ string, start, end int64, buf []byte) (
+			bool, error) {
+
+			var rec data.Record
+			if err := rec.Unmarshal(buf); err != nil {
+				return false, errs.Wrap(err)
+			}
+			if err := merger.Push(ctx, rec); err != nil {
+				return false, errs.Wrap(err)
+			}
+			return end >= stop_before, nil
+		})
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	cols, err := merger.Finish(ctx)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	// a nil set of columns means not to compare when drawing
+	if cols == nil {
+		cols = []draw.Column{}
+	}
+	return cols, nil
+}
+
+// serveGrid serves either a png of a grid of graphs, one for every metric
+// matching the query, or a json encoded set of columns for each. Every graph
+// is measured with the same options so that their axes are comparable.
+func (s *Server) serveGrid(ctx context.Context, w http.ResponseWriter,
+	req *http.Request) (err error) {
+
+	_query := req.FormValue("query")
+	if _query == "" {
+		return errBadRequest.New("query required")
+	}
+	metrics, err := s.matchMetrics(ctx, _query,
+		getInt(req.FormValue("limit"), 16))
+	if err != nil {
+		return err
+	}
+	columns := getInt(req.FormValue("columns"), 0)
+
+	// get the render parameters. the width and height are for each panel.
+	params, err := getRenderParams(ctx, req, 400, 200)
+	if err != nil {
+		return err
+	}
+	ctx = database.WithResolution(ctx, params.resolution())
+	stop_before := params.measure.Now - params.measure.Duration.Nanoseconds()
+	measure_opts := params.measure
+
+	// index the metrics so that results from batch queries, which may come
+	// in any order, can be put back in the order of the metrics.
+	indexes := make(map[string]int, len(metrics))
+	for i, metric := range metrics {
+		indexes[metric] = i
+	}
+
+	// merge the latest record of every metric to use as the earliest, so
+	// that every panel is measured with the same axes.
+	latest_by := make([]*data.Record, len(metrics))
+	err = database.QueryBatch(ctx, s.db, metrics, -1<<63, measure_opts.Now,
+		func(ctx context.Context, metric string, start, end int64,
+			buf []byte) (bool, error) {
+
+			var rec data.Record
+			if err := rec.Unmarshal(buf); err != nil {
+				return false, errs.Wrap(err)
+			}
+			latest_by[indexes[metric]] = &rec
+			return false, nil
+		})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	var latest []data.Record
+	for _, rec := range latest_by {
+		if rec != nil {
+			latest = append(latest, *rec)
+		}
+	}
+
+	var earliest []byte
+	if len(latest) > 0 {
+		rec, err := merge.Merge(ctx, merge.MergeOptions{
+			Params:  params.merger.Params,
+			Records: latest,
+		})
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		earliest, err = rec.Marshal()
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		measure_opts.Earliest, err = load.Load(ctx, rec)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+	}
+
+	measured, ok := graph.Measure(ctx, measure_opts)
+	if !ok {
+		return errs.New("too small")
+	}
+
+	// merge the columns for every metric
+	mergers := make([]*merge.Merger, len(metrics))
+	for i := range mergers {
+		mergers[i] = merge.NewMerger(params.merger)
+		mergers[i].SetWidth(measured.Width)
+	}
+
+	err = database.QueryBatch(ctx, s.db, metrics, -1<<63, measure_opts.Now,
+		func(ctx context.Context, metric string, start, end int64,
+			buf []byte) (bool, error) {
+
+			var rec data.Record
+			if err := rec.Unmarshal(buf); err != nil {
+				return false, errs.Wrap(err)
+			}
+			err := mergers[indexes[metric]].Push(ctx, rec)
+			if err != nil {
+				return false, errs.Wrap(err)
+			}
+			return end >= stop_before, nil
+		})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	panels := make([]grid.Panel, 0, len(metrics))
+	converted := false
+	for i, metric := range metrics {
+		cols, err := mergers[i].Finish(ctx)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		converted = converted || mergers[i].Converted()
+
+		panels = append(panels, grid.Panel{
+			Title:   metric,
+			Columns: cols,
+		})
+	}
+
+	// let the client know if any graph mixes distribution kinds
+	if converted {
+		w.Header().Set("X-Rothko-Converted", "true")
+	}
+
+	// if it's json, encode it out
+	if req.Header.Get("Accept") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		type D = map[string]interface{}
+		out := make([]D, 0, len(panels))
+		for _, panel := range panels {
+			out = append(out, D{
+				"metric":  panel.Title,
+				"columns": panel.Columns,
+			})
+		}
+		return errs.Wrap(json.NewEncoder(w).Encode(D{
+			"query":     _query,
+			"metrics":   metrics,
+			"panels":    out,
+			"earliest":  earliest,
+			"now":       measure_opts.Now,
+			"duration":  measure_opts.Duration.Nanoseconds(),
+			"width":     measure_opts.Width,
+			"height":    measure_opts.Height,
+			"padding":   measure_opts.Padding,
+			"converted": converted,
+		}))
+	}
+
+	// draw the grid
+	out := grid.Draw(ctx, grid.Options{
+		Measured: measured,
+		Panels:   panels,
+		Columns:  columns,
+		Colors:   colors.Viridis,
 	})
 
 	// encode it out as a png
@@ -270,6 +585,226 @@ func (s *Server) serveRender(ctx context.Context, w http.ResponseWriter,
 	return errs.Wrap(png.Encode(w, out.AsImage()))
 }
 
+// serveCompare serves a json encoded comparison of the distribution of a
+// metric in a recent window against a baseline window. The recent window is
+// the duration before now, and the baseline window is the baseline_duration
+// before the baseline_offset before now. By default the baseline is the
+// window of the same duration immediately before the recent window.
+func (s *Server) serveCompare(ctx context.Context, w http.ResponseWriter,
+	req *http.Request) (err error) {
+
+	metric := req.FormValue("metric")
+	if metric == "" {
+		return errBadRequest.New("metric required")
+	}
+	now := getInt64(req.FormValue("now"), time.Now().UnixNano())
+	dur := getDuration(req.FormValue("duration"), time.Hour)
+	baseline_offset := getDuration(req.FormValue("baseline_offset"), dur)
+	baseline_dur := getDuration(req.FormValue("baseline_duration"), dur)
+	samples := getInt(req.FormValue("samples"), analysis.DefaultSamples)
+
+	var quantiles []float64
+	if list := req.FormValue("quantiles"); list != "" {
+		quantiles, err = getFloat64s(list)
+		if err != nil {
+			return errBadRequest.Wrap(err)
+		}
+	}
+
+	params, err := getDistParams(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// merge the records in both windows
+	recent_end := now
+	recent_start := recent_end - dur.Nanoseconds()
+	recent, err := analysis.Window(ctx, s.db, metric,
+		recent_start, recent_end, params)
+	if err != nil {
+		return windowError(err)
+	}
+
+	baseline_end := now - baseline_offset.Nanoseconds()
+	baseline_start := baseline_end - baseline_dur.Nanoseconds()
+	baseline, err := analysis.Window(ctx, s.db, metric,
+		baseline_start, baseline_end, params)
+	if err != nil {
+		return windowError(err)
+	}
+
+	cmp, err := analysis.Compare(ctx, baseline, recent, analysis.Options{
+		Samples:   samples,
+		Quantiles: quantiles,
+	})
+	if err != nil {
+		return errBadRequest.Wrap(err)
+	}
+
+	type D = map[string]interface{}
+	deltas := make([]D, 0, len(cmp.Quantiles))
+	for _, q := range cmp.Quantiles {
+		deltas = append(deltas, D{
+			"quantile": q.Quantile,
+			"baseline": q.Baseline,
+			"recent":   q.Recent,
+			"delta":    q.Delta,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return errs.Wrap(json.NewEncoder(w).Encode(D{
+		"metric": metric,
+		"baseline": D{
+			"start":        baseline_start,
+			"end":          baseline_end,
+			"observations": cmp.BaselineCount,
+		},
+		"recent": D{
+			"start":        recent_start,
+			"end":          recent_end,
+			"observations": cmp.RecentCount,
+		},
+		"ks":          cmp.KS,
+		"wasserstein": cmp.Wasserstein,
+		"quantiles":   deltas,
+	}))
+}
+
+// windowError returns the error from merging the records in a window with
+// the status code for it: windows without data are not found, and windows
+// that end before they start are bad requests.
+func windowError(err error) error {
+	switch {
+	case analysis.NoData.Has(err):
+		return errNotFound.Wrap(err)
+	case analysis.BadRange.Has(err):
+		return errBadRequest.Wrap(err)
+	default:
+		return errs.Wrap(err)
+	}
+}
+
+// renderParams are the parameters for rendering graphs from a request.
+type renderParams struct {
+	measure graph.MeasureOptions
+	merger  merge.MergerOptions
+}
+
+// resolution returns how much time each pixel of the graph covers, so that
+// the database can use records that are no coarser than that.
+func (p renderParams) resolution() time.Duration {
+	if p.measure.Width <= 0 {
+		return 0
+	}
+	return p.measure.Duration / time.Duration(p.measure.Width)
+}
+
+// getRenderParams reads the parameters for rendering graphs out of the
+// request, with the default width and height for the graph.
+func getRenderParams(ctx context.Context, req *http.Request,
+	width, height int) (params renderParams, err error) {
+
+	width = getInt(req.FormValue("width"), width)
+	height = getInt(req.FormValue("height"), height)
+	padding := getInt(req.FormValue("padding"), 0)
+	now := getInt64(req.FormValue("now"), time.Now().UnixNano())
+	dur := getDuration(req.FormValue("duration"), 24*time.Hour)
+	samples := getInt(req.FormValue("samples"), 30)
+	exact := getBool(req.FormValue("exact"), false)
+	half_life := getDuration(req.FormValue("half_life"), 0)
+	sampling := getString(req.FormValue("sampling"), "uniform")
+	precision, err := merge.ParsePrecision(
+		getString(req.FormValue("precision"), "half"))
+	if err != nil {
+		return params, errBadRequest.Wrap(err)
+	}
+
+	dist_params, err := getDistParams(ctx, req)
+	if err != nil {
+		return params, err
+	}
+
+	// pick the quantiles to sample every column at. an explicit list of
+	// quantiles takes precedence over the sampling scheme.
+	var quantiles []float64
+	switch sampling {
+	case "uniform":
+	case "tail":
+		quantiles = merge.TailQuantiles(samples)
+	default:
+		return params, errBadRequest.New("unknown sampling: %q", sampling)
+	}
+	if list := req.FormValue("quantiles"); list != "" {
+		quantiles, err = getFloat64s(list)
+		if err != nil {
+			return params, errBadRequest.Wrap(err)
+		}
+	}
+	if quantiles != nil {
+		if err := merge.CheckQuantiles(quantiles); err != nil {
+			return params, errBadRequest.Wrap(err)
+		}
+	}
+
+	return renderParams{
+		measure: graph.MeasureOptions{
+			Now:      now,
+			Duration: dur,
+			Width:    width,
+			Height:   height,
+			Padding:  padding,
+			ExactCDF: exact,
+		},
+		merger: merge.MergerOptions{
+			Samples:   samples,
+			Now:       now,
+			Duration:  dur,
+			Params:    dist_params,
+			HalfLife:  half_life,
+			Quantiles: quantiles,
+			Precision: precision,
+		},
+	}, nil
+}
+
+// getDistParams reads the params for the kind of distribution to merge
+// into out of the request.
+func getDistParams(ctx context.Context, req *http.Request) (
+	dist.Params, error) {
+
+	kind := getString(req.FormValue("dist"), "tdigest")
+	compression := getFloat64(req.FormValue("compression"), 5)
+	order := getInt64(req.FormValue("order"), 0)
+
+	// the config passed is built from the request, and kinds only look at
+	// the values they care about.
+	params, err := registry.NewDistribution(ctx, kind,
+		map[string]interface{}{
+			"compression": compression,
+			"order":       order,
+		})
+	if err != nil {
+		return nil, errBadRequest.Wrap(err)
+	}
+	return params, nil
+}
+
+// matchMetrics returns up to limit metrics matching the query. It is an
+// error if no metrics match.
+func (s *Server) matchMetrics(ctx context.Context, _query string,
+	limit int) ([]string, error) {
+
+	search := query.New(_query, limit)
+	if err := s.db.Metrics(ctx, search.Add); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if len(search.Matched()) == 0 {
+		return nil, errNotFound.New("no metrics match query: %q", _query)
+	}
+	return search.Matched(), nil
+}
+
 // serveQuery returns a set of metrics that match the query as a json list.
 func (s *Server) serveQuery(ctx context.Context, w http.ResponseWriter,
 	req *http.Request) (err error) {
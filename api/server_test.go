@@ -0,0 +1,294 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/database/files"
+	"github.com/zeebo/rothko/dist/tdigest"
+	"github.com/zeebo/rothko/draw"
+	"github.com/zeebo/rothko/draw/colors"
+	"github.com/zeebo/errs"
+)
+
+var ctx = context.Background()
+
+// testNow is the time the test records end before.
+var testNow = time.Unix(1000000, 0).UnixNano()
+
+// newTestServer returns a server over a files database with ten one minute
+// records for every metric, ending at testNow.
+func newTestServer(t *testing.T, opts Options, metrics ...string) (
+	*Server, func()) {
+
+	dir, err := ioutil.TempDir("", "api-")
+	assert.NoError(t, err)
+
+	db := files.New(dir, files.Options{
+		Size:  1024,
+		Cap:   100,
+		Files: 2,
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	go db.Run(ctx)
+
+	done := make(chan error, 1)
+	for i, metric := range metrics {
+		for j := int64(10); j > 0; j-- {
+			start := testNow - j*int64(time.Minute)
+			end := start + int64(time.Minute)
+
+			d, err := tdigest.Params{Compression: 5}.New()
+			assert.NoError(t, err)
+			for k := 0; k < 10; k++ {
+				d.Observe(float64(i*10 + k))
+			}
+			buf, err := (&data.Record{
+				StartTime:    start,
+				EndTime:      end,
+				Observations: 10,
+				Distribution: d.Marshal(nil),
+				Kind:         d.Kind(),
+				Merged:       1,
+				Min:          float64(i * 10),
+				Max:          float64(i*10 + 9),
+			}).Marshal()
+			assert.NoError(t, err)
+
+			assert.NoError(t, db.Queue(ctx, metric, start, end, buf,
+				func(ok bool, err error) {
+					if err == nil && !ok {
+						err = errs.New("not written")
+					}
+					done <- err
+				}))
+			assert.NoError(t, <-done)
+		}
+	}
+
+	return New(db, nil, opts), func() {
+		cancel()
+		os.RemoveAll(dir)
+	}
+}
+
+// testGet issues a GET request to the server for the path with the values
+// and returns the response.
+func testGet(t *testing.T, s *Server, path string, values url.Values,
+	accept string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest("GET", path+"?"+values.Encode(), nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Log(rec.Body.String())
+	}
+	return rec
+}
+
+// testRenderValues returns the values to render the hour before testNow.
+func testRenderValues() url.Values {
+	return url.Values{
+		"now":      {strconv.FormatInt(testNow, 10)},
+		"duration": {"1h"},
+		"width":    {"100"},
+		"height":   {"50"},
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, cleanup := newTestServer(t, Options{}, "foo.a", "foo.b")
+	defer cleanup()
+
+	t.Run("Render", func(t *testing.T) {
+		values := testRenderValues()
+		values.Set("metric", "foo.a")
+
+		rec := testGet(t, s, "/api/render", values, "")
+		assert.Equal(t, rec.Code, http.StatusOK)
+		assert.Equal(t, rec.Header().Get("Content-Type"), "image/png")
+
+		rec = testGet(t, s, "/api/render", values, "application/json")
+		assert.Equal(t, rec.Code, http.StatusOK)
+
+		var out struct {
+			Columns []json.RawMessage `json:"columns"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&out))
+		assert.That(t, len(out.Columns) > 0)
+	})
+
+	t.Run("Grid", func(t *testing.T) {
+		values := testRenderValues()
+		values.Set("query", "foo")
+
+		rec := testGet(t, s, "/api/grid", values, "")
+		assert.Equal(t, rec.Code, http.StatusOK)
+		assert.Equal(t, rec.Header().Get("Content-Type"), "image/png")
+
+		rec = testGet(t, s, "/api/grid", values, "application/json")
+		assert.Equal(t, rec.Code, http.StatusOK)
+
+		var out struct {
+			Panels []struct {
+				Metric  string            `json:"metric"`
+				Columns []json.RawMessage `json:"columns"`
+			} `json:"panels"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&out))
+		assert.Equal(t, len(out.Panels), 2)
+		for _, panel := range out.Panels {
+			assert.That(t, len(panel.Columns) > 0)
+		}
+	})
+
+	t.Run("Difference", func(t *testing.T) {
+		// render returns the columns, the compare columns, and the columns
+		// of pixels of the png by how they differ.
+		render := func(t *testing.T, key, value string) (
+			cols, compare_cols []draw.Column, same, lower int) {
+
+			values := testRenderValues()
+			values.Set("metric", "foo.a")
+			values.Set("duration", "10m")
+			values.Set("width", "600")
+			values.Set("height", "200")
+			values.Set(key, value)
+
+			rec := testGet(t, s, "/api/render", values, "application/json")
+			assert.Equal(t, rec.Code, http.StatusOK)
+
+			var out struct {
+				Columns        []draw.Column `json:"columns"`
+				CompareColumns []draw.Column `json:"compare_columns"`
+			}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&out))
+
+			rec = testGet(t, s, "/api/render", values, "")
+			assert.Equal(t, rec.Code, http.StatusOK)
+			assert.Equal(t, rec.Header().Get("Content-Type"), "image/png")
+
+			same, lower = testDifferences(t, rec.Body.Bytes())
+			return out.Columns, out.CompareColumns, same, lower
+		}
+
+		// every value of foo.b is larger than every value of foo.a.
+		t.Run("Metric", func(t *testing.T) {
+			cols, compare_cols, same, lower := render(t, "compare", "foo.b")
+			assert.Equal(t, same, 0)
+			assert.Equal(t, lower, testOverlap(cols, compare_cols))
+		})
+
+		// the records are the same every minute, so every pixel with data
+		// in both is drawn with no difference.
+		t.Run("Aligned", func(t *testing.T) {
+			cols, compare_cols, same, lower := render(t,
+				"compare_offset", "-1m")
+			assert.Equal(t, cols[0].X, compare_cols[0].X)
+			assert.Equal(t, same, testOverlap(cols, compare_cols))
+			assert.Equal(t, lower, 0)
+		})
+
+		t.Run("Misaligned", func(t *testing.T) {
+			cols, compare_cols, same, lower := render(t,
+				"compare_offset", "-90s")
+			assert.That(t, cols[0].X != compare_cols[0].X)
+			assert.Equal(t, same, testOverlap(cols, compare_cols))
+			assert.Equal(t, lower, 0)
+		})
+	})
+
+	t.Run("Compare", func(t *testing.T) {
+		compare := func(t *testing.T, key, value string) int {
+			values := url.Values{
+				"metric":   {"foo.a"},
+				"now":      {strconv.FormatInt(testNow, 10)},
+				"duration": {"5m"},
+			}
+			values.Set(key, value)
+			return testGet(t, s, "/api/compare", values, "").Code
+		}
+
+		assert.Equal(t, compare(t, "metric", "foo.a"), http.StatusOK)
+		assert.Equal(t, compare(t, "baseline_offset", "1h"),
+			http.StatusNotFound)
+		assert.Equal(t, compare(t, "duration", "-5m"), http.StatusBadRequest)
+	})
+}
+
+// testOverlap returns how many pixels are covered by both sets of columns.
+func testOverlap(a, b []draw.Column) (n int) {
+	covered := make(map[int]bool)
+	for _, col := range a {
+		for x := col.X; x < col.X+col.W; x++ {
+			covered[x] = true
+		}
+	}
+	for _, col := range b {
+		for x := col.X; x < col.X+col.W; x++ {
+			if covered[x] {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// testDifferences decodes the png of a difference heatmap and returns how
+// many columns of pixels show no difference, and how many show a smaller
+// value than the compare column. The key has both kinds of colors, so it is
+// in neither.
+func testDifferences(t *testing.T, buf []byte) (same, lower int) {
+	img, err := png.Decode(bytes.NewReader(buf))
+	assert.NoError(t, err)
+
+	index := make(map[draw.Color]int)
+	for i, c := range colors.Diverging {
+		index[c] = i
+	}
+	middle := len(colors.Diverging) / 2
+
+	bounds := img.Bounds()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		var below, near, above int
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			i, ok := index[draw.Color{R: uint8(r >> 8), G: uint8(g >> 8),
+				B: uint8(b >> 8)}]
+			switch {
+			case !ok:
+			case i < middle-8:
+				below++
+			case i > middle+8:
+				above++
+			default:
+				near++
+			}
+		}
+
+		switch {
+		case near > 0 && below == 0 && above == 0:
+			same++
+		case below > near && above == 0:
+			lower++
+		}
+	}
+	return same, lower
+}
@@ -53,39 +53,104 @@ var InitialConfig = strings.TrimSpace(`
 # assuming that size is sufficient to hold a single record. Metric data will be
 # split into multiple records, if necessary.
 #
+# Since that depends on how often metrics are reported, a retention may be
+# given instead, possibly in days. Files that only contain data older than the
+# retention are removed periodically. If files is 0, the retention is the only
+# bound on how much data is kept.
+#
+# Metrics that have not been written for the idle duration are deleted
+# entirely. If 0 or not set, metrics are never deleted.
+#
+# If wal is true, every record is appended to a write-ahead log and synced to
+# disk in batches before it is written to the files, and the log is replayed
+# on startup. Records that were logged before a crash of the process or
+# machine are then kept, and only records still waiting in the buffer to be
+# logged are lost. Each batch costs an fsync.
+#
+# If compress is true, records are compressed before they are written, which
+# uses less disk and fewer records per value at the cost of some cpu. Records
+# written either way can always be read.
+#
 
 [database.files]
 	directory = "data"
 	size = 256
 	cap = 400
 	files = 2
+	# retention = "90d"
+	# idle = "30d"
+	# wal = false
+	# compress = false
 
 #
 # The files database allows some tuning:
 #
 #	buffer: controls how many records will be buffered while writing them to
-#	        disk.
+#	        disk. Each worker also buffers up to this many records, and when
+#	        one is full, records for every worker wait for it.
 #
 #	drop: if true, the process flushing the records to be written will drop
-#	      records if they can not be immediately added to the buffer. otherwise
-#	      it will block until the record is collected to be written.
+#	      records if they can not be immediately added to the buffer, or to
+#	      the buffer of the worker for the metric, even if they are already
+#	      in the write-ahead log. otherwise it will block until the record
+#	      is collected to be written.
 #
 #	workers: specifies the number of workers writing records to disk. If 0 or
 #	         not set, will use GOMAXPROCS - 1. The number of workers should be
 #	         less than GOMAXPROCS because they used mmap'd I/O to do writing,
 #	         and the Go runtime cannot schedule around those memory accesses
-#	         blocking.
+#	         blocking. Every record for a metric is written by the same
+#	         worker, in the order they were received.
 #
 #	handles: specifies the number of handles to keep in a cache for the metric
 #	         files. If 0 or unspecified, then 1024 less than the soft limit of
 #	         file handles as reported by getrlimit is used.
 #
+#	wal_size: the size in bytes a write-ahead log segment grows to before a new
+#	          one is started. If 0 or not set, 64MB is used.
+#
+#	query_workers: specifies the number of workers reading metrics in parallel
+#	               when many are queried at once, like for a grid. If 0 or not
+#	               set, will use GOMAXPROCS.
+#
+#	rollup_interval: how often the rollups below are built. If 0 or
+#	                 unspecified, they are built every minute.
+#
+#	retention_interval: how often files past the retention and idle metrics
+#	                    are removed. If 0 or unspecified, they are removed
+#	                    every minute.
+#
 
 # [database.files.tuning]
 # 	buffer = 20000
 # 	drop = false
 # 	workers = 0
 # 	handles = 0
+# 	query_workers = 0
+# 	wal_size = 67108864
+# 	rollup_interval = "1m"
+# 	retention_interval = "1m"
+
+#
+# The files database can also keep rollups: tiers of coarser records merged in
+# the background, so that long periods can be kept without huge files. Each
+# tier is built from the one before it, so they must be listed in increasing
+# order of resolution. Records in a tier are removed once they are older than
+# its retention, which may be given in days. Queries for long periods read
+# from the coarsest tier that is still finer than a pixel of the graph.
+#
+
+# [[database.files.rollups]]
+# 	resolution = "10m"
+# 	retention = "7d"
+#
+# [[database.files.rollups]]
+# 	resolution = "1h"
+# 	retention = "90d"
+#
+# [[database.files.rollups]]
+# 	resolution = "24h"
+# 	retention = "730d"
 
 #
 # The distribution sketch that the metrics will be stored with. A T-Digest
@@ -95,6 +160,26 @@ var InitialConfig = strings.TrimSpace(`
 [dist.tdigest]
 	compression = 5.0
 
+#
+# A moments sketch is also provided. It keeps a fixed number of power sums of
+# the values, and merges exactly and cheaply, which makes rendering long
+# periods fast at the cost of less accurate quantiles. The order is the number
+# of power sums kept, and defaults to 10 if not set.
+#
+
+# [dist.moments]
+# 	order = 10
+
+#
+# A log-linear histogram is also provided. It counts values in base 10 bins
+# with two significant digits, so every quantile is within 10% of the true
+# value no matter how many orders of magnitude the values span. It is well
+# suited to things like byte counts and queue depths, and has no options.
+# Only one dist section may be specified, so replace the one above to use it.
+#
+
+# [dist.loglinear]
+
 #
 # The server runs an API for querying the metrics, as well as a web interface
 # for rendering and interacting. The address is the port that the server will
@@ -118,7 +203,9 @@ var InitialConfig = strings.TrimSpace(`
 #
 # If the api.security section is specified, the resources will all be protected
 # by http basic auth. Consider using the api.tls section if you use this as
-# http basic auth sends the credentials in the clear.
+# http basic auth sends the credentials in the clear. Metrics can only be
+# deleted (DELETE /api/metric?metric=name) or renamed
+# (POST /api/rename?from=name&to=other) when it is specified.
 #
 
 # [api.security]
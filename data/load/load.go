@@ -12,6 +12,10 @@ import (
 
 // TODO(jeff): this package is in a weird spot.
 
+// Resamples is the maximum number of quantiles sampled from a distribution
+// when it has to be converted into a distribution of a different kind.
+const Resamples = 128
+
 // Load returns the dist.Dist for the data.Record.
 func Load(ctx context.Context, rec data.Record) (dist.Dist, error) {
 	params, err := registry.NewDistribution(ctx, rec.Kind, nil)
@@ -20,3 +24,81 @@ func Load(ctx context.Context, rec data.Record) (dist.Dist, error) {
 	}
 	return params.Unmarshal(rec.Distribution)
 }
+
+// Convert returns a dist.Dist of the kind described by params containing the
+// observations in the data.Record. If the record is of a different kind, it
+// is resampled and converted is true.
+func Convert(ctx context.Context, rec data.Record, params dist.Params) (
+	out dist.Dist, converted bool, err error) {
+
+	if rec.Kind == params.Kind() {
+		out, err = params.Unmarshal(rec.Distribution)
+		return out, false, err
+	}
+
+	out, err = params.New()
+	if err != nil {
+		return nil, false, err
+	}
+	converted, err = Into(ctx, out, rec)
+	return out, converted, err
+}
+
+// Into adds the observations in the data.Record into the out distribution.
+// If the record is of the same kind and out implements dist.Merger, the
+// distributions are merged directly. Otherwise, the record's distribution is
+// resampled by quantiles, each weighted so that the total weight is the
+// number of observations in the record, and converted is true.
+func Into(ctx context.Context, out dist.Dist, rec data.Record) (
+	converted bool, err error) {
+
+	in, err := Load(ctx, rec)
+	if err != nil {
+		return false, err
+	}
+
+	if merger, ok := out.(dist.Merger); ok && in.Kind() == out.Kind() {
+		return false, merger.Merge(in)
+	}
+
+	return in.Kind() != out.Kind(), Resample(ctx, out, in, rec.Observations)
+}
+
+// Resample adds count observations into out that are distributed like in. It
+// samples at most Resamples evenly spaced quantiles from in, and gives each
+// an integral weight such that they sum to count. If count is not positive,
+// the number of observations in the in distribution is used.
+func Resample(ctx context.Context, out, in dist.Dist, count int64) error {
+	if count <= 0 {
+		count = in.Len()
+	}
+	if count <= 0 {
+		return nil
+	}
+
+	samples := int64(Resamples)
+	if count < samples {
+		samples = count
+	}
+
+	weighted, _ := out.(dist.WeightedObserver)
+	for i := int64(0); i < samples; i++ {
+		// sample at the midpoint of each bucket of quantiles, and pick the
+		// weight so that rounding errors never accumulate.
+		val := in.Query((float64(i) + 0.5) / float64(samples))
+		weight := (i+1)*count/samples - i*count/samples
+		if weight <= 0 {
+			continue
+		}
+
+		if weighted != nil {
+			weighted.ObserveWeighted(val, weight)
+			continue
+		}
+		for j := int64(0); j < weight; j++ {
+			out.Observe(val)
+		}
+	}
+
+	return nil
+}
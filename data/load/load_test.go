@@ -0,0 +1,115 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package load
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/dist/moments"
+	"github.com/zeebo/rothko/dist/tdigest"
+)
+
+var ctx = context.Background()
+
+func newTestRecord(t *testing.T, params dist.Params, n int) data.Record {
+	t.Helper()
+
+	d, err := params.New()
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		d.Observe(float64(i))
+	}
+
+	return data.Record{
+		Observations: int64(n),
+		Distribution: d.Marshal(nil),
+		Kind:         d.Kind(),
+		Merged:       1,
+	}
+}
+
+func TestConvert(t *testing.T) {
+	params := tdigest.Params{Compression: 5}
+	rec := newTestRecord(t, params, 1000)
+
+	t.Run("Same Kind", func(t *testing.T) {
+		out, converted, err := Convert(ctx, rec, params)
+		assert.NoError(t, err)
+		assert.That(t, !converted)
+		assert.Equal(t, out.Len(), int64(1000))
+	})
+
+	t.Run("Into", func(t *testing.T) {
+		out, err := params.New()
+		assert.NoError(t, err)
+
+		converted, err := Into(ctx, out, rec)
+		assert.NoError(t, err)
+		assert.That(t, !converted)
+
+		converted, err = Into(ctx, out, rec)
+		assert.NoError(t, err)
+		assert.That(t, !converted)
+		assert.Equal(t, out.Len(), int64(2000))
+	})
+
+	t.Run("Resample", func(t *testing.T) {
+		in, err := Load(ctx, rec)
+		assert.NoError(t, err)
+		out, err := params.New()
+		assert.NoError(t, err)
+
+		// resampling should carry the observation count as the total weight
+		// even when it differs from the distribution's own count.
+		assert.NoError(t, Resample(ctx, out, in, 5000))
+		assert.Equal(t, out.Len(), int64(5000))
+		assert.That(t, math.Abs(out.Query(0.5)-in.Query(0.5)) < 50)
+	})
+}
+
+func TestConvertKinds(t *testing.T) {
+	td_params := tdigest.Params{Compression: 5}
+	mo_params := moments.Params{}
+
+	t.Run("TDigest To Moments", func(t *testing.T) {
+		rec := newTestRecord(t, td_params, 1000)
+
+		out, converted, err := Convert(ctx, rec, mo_params)
+		assert.NoError(t, err)
+		assert.That(t, converted)
+		assert.Equal(t, out.Kind(), "moments")
+		assert.Equal(t, out.Len(), int64(1000))
+		assert.That(t, math.Abs(out.Query(0.5)-500) < 50)
+	})
+
+	t.Run("Moments To TDigest", func(t *testing.T) {
+		rec := newTestRecord(t, mo_params, 1000)
+
+		out, converted, err := Convert(ctx, rec, td_params)
+		assert.NoError(t, err)
+		assert.That(t, converted)
+		assert.Equal(t, out.Kind(), "tdigest")
+		assert.Equal(t, out.Len(), int64(1000))
+		assert.That(t, math.Abs(out.Query(0.5)-500) < 50)
+	})
+
+	t.Run("Mixed", func(t *testing.T) {
+		out, err := td_params.New()
+		assert.NoError(t, err)
+
+		converted, err := Into(ctx, out, newTestRecord(t, td_params, 1000))
+		assert.NoError(t, err)
+		assert.That(t, !converted)
+
+		converted, err = Into(ctx, out, newTestRecord(t, mo_params, 3000))
+		assert.NoError(t, err)
+		assert.That(t, converted)
+
+		assert.Equal(t, out.Len(), int64(4000))
+	})
+}
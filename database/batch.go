@@ -0,0 +1,52 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"context"
+)
+
+// BatchCallback is a function used to pass results back from QueryBatch. It
+// is like a ResultCallback, but is also passed the metric the data is for.
+// Returning false stops passing data for only that metric.
+type BatchCallback func(ctx context.Context, metric string, start, end int64,
+	data []byte) (bool, error)
+
+// BatchSource is a Source that can query many metrics at once more
+// efficiently than one at a time.
+type BatchSource interface {
+	Source
+
+	// QueryBatch calls the BatchCallback with the data slices for every
+	// metric that end strictly after the start time and strictly before the
+	// end time. The data for each metric is passed in strictly decreasing
+	// order by their end, but the data for different metrics may be
+	// interleaved in any order. The BatchCallback is never called
+	// concurrently. It returns the first error from any metric.
+	QueryBatch(ctx context.Context, metrics []string, start, end int64,
+		cb BatchCallback) error
+}
+
+// QueryBatch calls QueryBatch on the source if it is a BatchSource, and
+// otherwise calls QueryRange for each metric in order.
+func QueryBatch(ctx context.Context, source Source, metrics []string,
+	start, end int64, cb BatchCallback) error {
+
+	if batch, ok := source.(BatchSource); ok {
+		return batch.QueryBatch(ctx, metrics, start, end, cb)
+	}
+
+	for _, metric := range metrics {
+		metric := metric
+		err := QueryRange(ctx, source, metric, start, end, nil,
+			func(ctx context.Context, start, end int64, data []byte) (
+				bool, error) {
+
+				return cb(ctx, metric, start, end, data)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
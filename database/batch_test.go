@@ -0,0 +1,55 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestQueryBatch(t *testing.T) {
+	source := testSource{ends: map[string][]int64{
+		"a": {1, 2, 3, 4},
+		"b": {2, 4, 6},
+	}}
+
+	t.Run("Basic", func(t *testing.T) {
+		var got []string
+		err := QueryBatch(ctx, source, []string{"a", "b", "c"}, 1, 5,
+			func(ctx context.Context, metric string, start, end int64,
+				data []byte) (bool, error) {
+
+				got = append(got, fmt.Sprintf("%s@%d", metric, end))
+				return true, nil
+			})
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, []string{"a@4", "a@3", "a@2", "b@4", "b@2"})
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		var got []string
+		err := QueryBatch(ctx, source, []string{"a", "b"}, 0, 10,
+			func(ctx context.Context, metric string, start, end int64,
+				data []byte) (bool, error) {
+
+				got = append(got, fmt.Sprintf("%s@%d", metric, end))
+				return false, nil
+			})
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, []string{"a@4", "b@6"})
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		err := QueryBatch(ctx, source, []string{"a", "b"}, 0, 10,
+			func(ctx context.Context, metric string, start, end int64,
+				data []byte) (bool, error) {
+
+				return false, errors.New("problem")
+			})
+		assert.Error(t, err)
+	})
+}
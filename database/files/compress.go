@@ -0,0 +1,77 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+//
+// values are compressed with deflate before they are split into records, so
+// every record of a value has the same flags. the writers and readers are
+// large to allocate, so they are pooled.
+//
+
+// compressor compresses values with deflate.
+type compressor struct {
+	buf bytes.Buffer
+	w   *flate.Writer
+}
+
+// compressors is a pool of *compressor.
+var compressors = sync.Pool{
+	New: func() interface{} {
+		c := new(compressor)
+		c.w, _ = flate.NewWriter(&c.buf, flate.DefaultCompression)
+		return c
+	},
+}
+
+// Compress returns the compressed data. The returned slice is only valid
+// until the next call to Compress.
+func (c *compressor) Compress(data []byte) ([]byte, error) {
+	c.buf.Reset()
+	c.w.Reset(&c.buf)
+	if _, err := c.w.Write(data); err != nil {
+		return nil, Error.Wrap(err)
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, Error.Wrap(err)
+	}
+	return c.buf.Bytes(), nil
+}
+
+// decompressor decompresses values compressed with deflate.
+type decompressor struct {
+	src bytes.Reader
+	r   io.ReadCloser
+}
+
+// decompressors is a pool of *decompressor.
+var decompressors = sync.Pool{
+	New: func() interface{} {
+		d := new(decompressor)
+		d.r = flate.NewReader(&d.src)
+		return d
+	},
+}
+
+// inflate appends the decompressed data to dst, returning it.
+func inflate(dst, data []byte) ([]byte, error) {
+	d := decompressors.Get().(*decompressor)
+	defer decompressors.Put(d)
+
+	d.src.Reset(data)
+	if err := d.r.(flate.Resetter).Reset(&d.src, nil); err != nil {
+		return dst, Error.Wrap(err)
+	}
+
+	out := bytes.NewBuffer(dst)
+	if _, err := out.ReadFrom(d.r); err != nil {
+		return dst, Error.Wrap(err)
+	}
+	return out.Bytes(), nil
+}
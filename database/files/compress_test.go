@@ -0,0 +1,106 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/dist/tdigest"
+)
+
+func TestCompress(t *testing.T) {
+	t.Run("Roundtrip", func(t *testing.T) {
+		data := bytes.Repeat([]byte("some data "), 100)
+
+		c := compressors.Get().(*compressor)
+		defer compressors.Put(c)
+
+		compressed, err := c.Compress(data)
+		assert.NoError(t, err)
+		assert.That(t, len(compressed) < len(data))
+
+		out, err := inflate([]byte("prefix"), compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, string(out), "prefix"+string(data))
+
+		_, err = inflate(nil, compressed[:len(compressed)/2])
+		assert.Error(t, err)
+	})
+
+	t.Run("DB", func(t *testing.T) {
+		// write writes a value with many observations so that it is large
+		// enough to compress well.
+		write := func(db *DB, start, end int64) {
+			d, err := tdigest.Params{Compression: 50}.New()
+			assert.NoError(t, err)
+			for i := 0; i < 500; i++ {
+				d.Observe(float64(i % 10))
+			}
+			buf, err := (&data.Record{
+				StartTime:    start,
+				EndTime:      end,
+				Observations: 500,
+				Distribution: d.Marshal(nil),
+				Kind:         d.Kind(),
+				Merged:       1,
+			}).Marshal()
+			assert.NoError(t, err)
+
+			ok, err := db.write(ctx, 0, queuedValue{
+				metric: "metric",
+				start:  start,
+				end:    end,
+				data:   buf,
+			})
+			assert.NoError(t, err)
+			assert.That(t, ok)
+		}
+
+		opts := Options{
+			Size:  256,
+			Cap:   10,
+			Files: 10,
+		}
+		db, cleanup := newTestDB(t, opts)
+		defer cleanup()
+
+		// write some values without compression and some with, and make
+		// sure they can all be read back.
+		for i := int64(1); i <= 10; i++ {
+			write(db, i, i+1)
+		}
+		db.fch.Close()
+
+		opts.Compress = true
+		db = New(db.dir, opts)
+		for i := int64(11); i <= 20; i++ {
+			write(db, i, i+1)
+		}
+
+		recs := testQueryRecords(t, db, ctx, "metric")
+		assert.Equal(t, len(recs), 20)
+		for i, rec := range recs {
+			assert.Equal(t, rec.StartTime, int64(20-i))
+			assert.Equal(t, rec.Observations, int64(500))
+		}
+
+		// the latest value is compressed into a single record
+		m, err := db.newMetric(ctx, "metric", true)
+		assert.NoError(t, err)
+		f, head, err := m.acquireLast(ctx)
+		assert.NoError(t, err)
+		rec, err := f.Record(ctx, head+1)
+		assert.NoError(t, err)
+		m.opts.fch.releaseFile(m.filenameAt(m.last), f)
+		assert.Equal(t, rec.flags, recordFlags_deflate)
+		assert.Equal(t, rec.kind, recordKind_complete)
+
+		db.fch.Close()
+		problems, err := db.Check(ctx, false)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+	})
+}
@@ -40,16 +40,71 @@ type Options struct {
 	Cap   int // cap of the number of records per file
 	Files int // the number of historical files per metric
 
+	// Retention is how long records are kept, independent of how often they
+	// are written. Files that only contain records that ended before the
+	// retention are removed periodically. If zero, records are only bounded
+	// by the number of files. If files is zero, records are only bounded by
+	// the retention.
+	Retention time.Duration
+
+	// Idle is how long a metric can go without any records before it is
+	// deleted along with its rollups. If zero, metrics are never deleted.
+	Idle time.Duration
+
+	// WAL, when true, appends every queued value to a write-ahead log in the
+	// directory before it is written. The log is fsynced after every batch
+	// of values, and values are only handed to the workers once they are
+	// synced, so any value that a Queue callback reports as written survives
+	// a crash of the process or machine. Values still waiting to be logged
+	// when a crash happens are lost. On startup, every value in the log is
+	// written again, skipping the ones that are already stored. Deletes and
+	// renames are logged too, so that replaying does not bring back metrics
+	// under their old names.
+	WAL bool
+
+	// Compress, when true, compresses every value with deflate before it is
+	// split into records, if that makes it smaller. Records that are already
+	// written are read either way.
+	Compress bool
+
+	// Rollups are tiers of coarser records merged in the background from the
+	// records of the previous tier, starting with the flushed records, so
+	// that long periods can be kept and read cheaply. They must be in
+	// increasing order of resolution.
+	Rollups []Rollup
+
 	Tuning Tuning // tuning parameters
 }
 
+// Rollup describes a tier of records merged to a coarser resolution.
+type Rollup struct {
+	// Resolution is how much time each record in the tier covers. Records
+	// from the previous tier are grouped by when they start into windows of
+	// the resolution aligned to the unix epoch.
+	Resolution time.Duration
+
+	// Retention is how long records are kept in the tier. Files that only
+	// contain records that ended before the retention are removed. If zero,
+	// the records are kept forever.
+	Retention time.Duration
+}
+
+// tierName returns the name of the files for the tier of rollups.
+func (r Rollup) tierName() string {
+	return r.Resolution.String()
+}
+
 // Tuning controls some tuning details of the database.
 type Tuning struct {
 	// Buffer controls the number of records that can be queued for writing.
+	// Each worker also buffers up to this many records for its metrics. If
+	// a worker's buffer is full, queued records wait for it, which holds up
+	// the records for every other worker too.
 	Buffer int
 
 	// Drop, when true, will cause queued records to be discarded if the
-	// buffer is full.
+	// buffer, or the buffer of the worker for the metric, is full. Records
+	// discarded after being appended to the write-ahead log are lost too.
 	Drop bool
 
 	// Handles controls the number of open file handles for metrics in the
@@ -58,18 +113,42 @@ type Tuning struct {
 	Handles int
 
 	// Workers controls the number of parallel workers draining queued values
-	// into files. If zero, one less than GOMAXPROCS worker is used.
+	// into files. If zero, one less than GOMAXPROCS worker is used. Every
+	// value for a metric is written by the same worker, so they are written
+	// in the order they were queued.
 	//
 	// The number of workers should be less than GOMAXPROCS, because each
 	// worker deals with memory mapped files. The go runtime will not be able
 	// to schedule around goroutines blocked on page faults, which could cause
 	// goroutines to starve.
 	Workers int
+
+	// WALSize controls the size in bytes that a segment of the write-ahead
+	// log grows to before a new one is started. Old segments are removed
+	// once all of their values are written and synced. If zero, segments
+	// grow to 64MB.
+	WALSize int64
+
+	// QueryWorkers controls the number of parallel workers reading metrics
+	// for a batch query. If zero, GOMAXPROCS workers are used.
+	QueryWorkers int
+
+	// RollupInterval controls how often the rollup tiers are built. If zero,
+	// they are built every minute.
+	RollupInterval time.Duration
+
+	// RetentionInterval controls how often files past the retention and
+	// idle metrics are removed. If zero, they are removed every minute.
+	RetentionInterval time.Duration
 }
 
 // DB is a database implementing database.Sink and database.Source using a file
 // on disk for each metric.
 type DB struct {
+	// seq counts the values queued so far. it is first so that it is
+	// aligned for atomic operations.
+	seq uint64
+
 	dir  string
 	opts Options
 
@@ -92,6 +171,19 @@ type DB struct {
 	names_mu sync.Mutex
 	names    atomic.Value
 
+	// the seq of the last value queued before a metric was deleted or
+	// renamed, for metrics that may still have values like that waiting to
+	// be written. those values are discarded instead of bringing the metric
+	// back.
+	removed_mu sync.Mutex
+	removed    map[string]uint64
+
+	// the write-ahead log while running. wal_mu is held while the log is
+	// replayed, and by operations that log tombstones, before any metric
+	// locks.
+	wal_mu sync.Mutex
+	wal    *wal
+
 	// ensures that we only have one Run call
 	running junk.Flag
 }
@@ -101,6 +193,10 @@ var (
 	_ database.Source = (*DB)(nil)
 	_ database.Sink   = (*DB)(nil)
 	_ database.DB     = (*DB)(nil)
+
+	_ database.BatchSource = (*DB)(nil)
+	_ database.RangeSource = (*DB)(nil)
+	_ database.Manager     = (*DB)(nil)
 )
 
 // queuedValue represents some data queued to be written to db.
@@ -110,6 +206,14 @@ type queuedValue struct {
 	end    int64
 	data   []byte
 	done   func(bool, error)
+
+	// seq orders the value with the others queued. it is zero for values
+	// that were not queued, like the ones replayed from the log.
+	seq uint64
+
+	// logged is marked done once the value is written if it is in the
+	// write-ahead log.
+	logged *sync.WaitGroup
 }
 
 // New constructs a database with directory rooted at dir and the provided
@@ -125,6 +229,16 @@ func New(dir string, opts Options) *DB {
 		}
 	}
 
+	// set up the size of write-ahead log segments
+	if opts.Tuning.WALSize <= 0 {
+		opts.Tuning.WALSize = 64 << 20
+	}
+
+	// set up the number of query workers
+	if opts.Tuning.QueryWorkers <= 0 {
+		opts.Tuning.QueryWorkers = runtime.GOMAXPROCS(-1)
+	}
+
 	// set up the number of handles
 	if opts.Tuning.Handles == 0 {
 		var lim syscall.Rlimit
@@ -138,6 +252,16 @@ func New(dir string, opts Options) *DB {
 		opts.Tuning.Handles = 0
 	}
 
+	// set up the rollup interval
+	if opts.Tuning.RollupInterval <= 0 {
+		opts.Tuning.RollupInterval = time.Minute
+	}
+
+	// set up the retention interval
+	if opts.Tuning.RetentionInterval <= 0 {
+		opts.Tuning.RetentionInterval = time.Minute
+	}
+
 	var queue atomic.Value
 	queue.Store(make(chan queuedValue, opts.Tuning.Buffer))
 
@@ -164,6 +288,8 @@ func New(dir string, opts Options) *DB {
 
 		names_w_mu: make([]sync.Mutex, opts.Tuning.Workers),
 		names_w:    names_w,
+
+		removed: make(map[string]uint64),
 	}
 }
 
@@ -177,6 +303,30 @@ func (db *DB) newMetric(ctx context.Context, name string, read_only bool) (
 		name: name,
 		max:  db.opts.Files,
 		ro:   read_only,
+
+		compress: db.opts.Compress,
+	})
+}
+
+// newTierMetric constructs a *metric value for the tier of rollups. Tier 0
+// is the flushed records, and tier n is the rollup at n-1. Rollups are
+// only bounded by their retention.
+func (db *DB) newTierMetric(ctx context.Context, name string, tier int,
+	read_only bool) (*metric, error) {
+
+	if tier == 0 {
+		return db.newMetric(ctx, name, read_only)
+	}
+
+	return newMetric(ctx, metricOptions{
+		fch:  db.fch,
+		dir:  db.dir,
+		name: name,
+		max:  0,
+		ro:   read_only,
+		tier: db.opts.Rollups[tier-1].tierName(),
+
+		compress: db.opts.Compress,
 	})
 }
 
@@ -192,16 +342,68 @@ func (db *DB) Run(ctx context.Context) error {
 	// load up the current queue to run on
 	queue := db.queue.Load().(chan queuedValue)
 
-	// queue up the workers
 	var launcher junk.Launcher
 
-	for i := 0; i < db.opts.Tuning.Workers; i++ {
+	// if there's a write-ahead log, replay it and have the workers read the
+	// values once they are logged.
+	logged := queue
+	if db.opts.WAL {
+		db.wal_mu.Lock()
+		w, err := db.openWAL(ctx)
+		db.wal = w
+		db.wal_mu.Unlock()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			db.wal_mu.Lock()
+			db.wal = nil
+			db.wal_mu.Unlock()
+			w.close()
+		}()
+		logged = make(chan queuedValue, db.opts.Tuning.Buffer)
+
+		launcher.Queue(func(ctx context.Context) error {
+			w.run(ctx, queue, logged)
+			return nil
+		})
+		launcher.Queue(func(ctx context.Context) error {
+			w.checkpoint(ctx)
+			return nil
+		})
+	}
+
+	// queue up the workers, each with their own queue so that the values
+	// for a metric are always written by the same worker.
+	shards := make([]chan queuedValue, db.opts.Tuning.Workers)
+	for i := range shards {
 		i := i
+		shards[i] = make(chan queuedValue, db.opts.Tuning.Buffer)
 		launcher.Queue(func(ctx context.Context) error {
 			runtime.LockOSThread()
 			defer runtime.UnlockOSThread()
 
-			db.worker(ctx, i, queue)
+			db.worker(ctx, i, shards[i])
+			return nil
+		})
+	}
+	launcher.Queue(func(ctx context.Context) error {
+		db.dispatch(ctx, logged, shards)
+		return nil
+	})
+
+	// queue up building the rollup tiers
+	if len(db.opts.Rollups) > 0 {
+		launcher.Queue(func(ctx context.Context) error {
+			db.runRollups(ctx)
+			return nil
+		})
+	}
+
+	// queue up removing files past the retention and idle metrics
+	if db.opts.Retention > 0 || db.opts.Idle > 0 {
+		launcher.Queue(func(ctx context.Context) error {
+			db.runRetention(ctx)
 			return nil
 		})
 	}
@@ -239,9 +441,21 @@ func (db *DB) Run(ctx context.Context) error {
 	// writing to it recover any panics.
 	close(queue)
 	for val := range queue {
-		db.bufs.Put(val.data)
-		if val.done != nil {
-			val.done(false, nil)
+		db.abandon(val)
+	}
+
+	// empty out any logged values and the values waiting for a worker. if
+	// they were logged, they will be written on the next startup.
+	if logged != queue {
+		close(logged)
+		for val := range logged {
+			db.abandon(val)
+		}
+	}
+	for _, shard := range shards {
+		close(shard)
+		for val := range shard {
+			db.abandon(val)
 		}
 	}
 
@@ -0,0 +1,269 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zeebo/rothko/database/files/internal/sset"
+)
+
+// Delete removes all of the data stored for the metric, including any
+// rollups.
+func (db *DB) Delete(ctx context.Context, metric string) error {
+	unlock := db.lockWAL()
+	defer unlock()
+
+	db.locks.Lock(metric)
+	defer db.locks.Unlock(metric)
+
+	if err := db.deleteMetric(ctx, metric); err != nil {
+		return err
+	}
+
+	// values that are still queued would bring the metric back.
+	db.removeQueued(metric)
+	return nil
+}
+
+// deleteMetric removes all of the data stored for the metric. It must be
+// called with the write-ahead log and the lock for the metric held.
+func (db *DB) deleteMetric(ctx context.Context, metric string) error {
+	dir := db.metricDir(metric)
+	paths, err := dataFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return Error.New("unknown metric: %q", metric)
+	}
+
+	// log the delete before doing it so that replaying the values logged
+	// before it does not bring the metric back.
+	err = db.logTombstone(walEntry{
+		kind:  walKind_delete,
+		value: queuedValue{metric: metric},
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.removeFiles(metric, dir, paths)
+}
+
+// removeFiles removes the data files at the paths for the metric, and the
+// directory if it is left empty. It must be called with the lock for the
+// metric held.
+func (db *DB) removeFiles(metric, dir string, paths []string) error {
+	for _, path := range paths {
+		db.fch.evictFile(path)
+		if err := os.Remove(path); err != nil {
+			return Error.Wrap(err)
+		}
+	}
+
+	// the directory may still have other metrics nested inside of it, so
+	// only remove it if it's empty.
+	_ = os.Remove(dir)
+
+	db.forgetMetric(metric)
+	return nil
+}
+
+// Rename moves all of the data stored for the metric named from, including
+// any rollups, to the metric named to. It is an error if the metric named to
+// has data.
+func (db *DB) Rename(ctx context.Context, from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	unlock := db.lockWAL()
+	defer unlock()
+
+	unlock_metrics := db.lockPair(from, to)
+	defer unlock_metrics()
+
+	from_dir, to_dir := db.metricDir(from), db.metricDir(to)
+	paths, err := dataFiles(from_dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return Error.New("unknown metric: %q", from)
+	}
+	existing, err := dataFiles(to_dir)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return Error.New("metric already exists: %q", to)
+	}
+
+	// the values already written must be on disk before the rename is
+	// logged, because the log will only sync the files of the new name for
+	// the values logged after it.
+	if db.opts.WAL {
+		m, err := db.newMetric(ctx, from, true)
+		if err != nil {
+			return err
+		}
+		if err := m.Sync(ctx, -1<<63); err != nil {
+			return err
+		}
+	}
+
+	err = db.logTombstone(walEntry{
+		kind:  walKind_rename,
+		value: queuedValue{metric: from},
+		to:    to,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := db.moveFiles(from, to, paths); err != nil {
+		return err
+	}
+
+	// values that are still queued would bring the old name back.
+	db.removeQueued(from)
+	return nil
+}
+
+// lockPair locks both metrics in a consistent order to avoid deadlocks, and
+// returns a function to unlock them.
+func (db *DB) lockPair(a, b string) func() {
+	if b < a {
+		a, b = b, a
+	}
+	db.locks.Lock(a)
+	db.locks.Lock(b)
+	return func() {
+		db.locks.Unlock(b)
+		db.locks.Unlock(a)
+	}
+}
+
+// moveFiles moves the data files at the paths for the metric named from
+// into the directory for the metric named to. Files that the metric named to
+// already has are removed instead. It must be called with the locks for both
+// metrics held.
+func (db *DB) moveFiles(from, to string, paths []string) error {
+	from_dir, to_dir := db.metricDir(from), db.metricDir(to)
+	if err := os.MkdirAll(to_dir, 0755); err != nil {
+		return Error.Wrap(err)
+	}
+	for _, path := range paths {
+		db.fch.evictFile(path)
+		to_path := filepath.Join(to_dir, filepath.Base(path))
+		if _, err := os.Stat(to_path); err == nil {
+			if err := os.Remove(path); err != nil {
+				return Error.Wrap(err)
+			}
+			continue
+		}
+		if err := os.Rename(path, to_path); err != nil {
+			return Error.Wrap(err)
+		}
+	}
+	_ = os.Remove(from_dir)
+
+	db.forgetMetric(from)
+	db.names_w_mu[0].Lock()
+	db.names_w[0].Add(to)
+	db.names_w_mu[0].Unlock()
+
+	return nil
+}
+
+// metricDir returns the directory containing the files for the metric.
+func (db *DB) metricDir(metric string) string {
+	dir_buf := make([]byte, 0, len(db.dir)+1+len(metric))
+	dir_buf = append(dir_buf, db.dir...)
+	if len(dir_buf) > 0 && dir_buf[len(dir_buf)-1] != '/' {
+		dir_buf = append(dir_buf, '/')
+	}
+	return string(metricToDir(dir_buf, metric))
+}
+
+// removeQueued causes every value queued so far for the metric to be
+// discarded instead of written. It must be called with the lock for the
+// metric held.
+func (db *DB) removeQueued(metric string) {
+	db.removed_mu.Lock()
+	defer db.removed_mu.Unlock()
+
+	db.removed[metric] = atomic.LoadUint64(&db.seq)
+}
+
+// queuedBeforeRemove returns true if the value was queued before its metric
+// was removed. Values for a metric are written in the order they were
+// queued, so once a later value is written, no earlier one is left. It must
+// be called with the lock for the metric held.
+func (db *DB) queuedBeforeRemove(value queuedValue) bool {
+	if value.seq == 0 {
+		return false
+	}
+
+	db.removed_mu.Lock()
+	defer db.removed_mu.Unlock()
+
+	seq, ok := db.removed[value.metric]
+	if !ok {
+		return false
+	}
+	if value.seq <= seq {
+		return true
+	}
+	delete(db.removed, value.metric)
+	return false
+}
+
+// forgetMetric removes the metric from the cached metric names.
+func (db *DB) forgetMetric(metric string) {
+	db.names_mu.Lock()
+	defer db.names_mu.Unlock()
+
+	for i := range db.names_w {
+		db.names_w_mu[i].Lock()
+		db.names_w[i].Remove(metric)
+		db.names_w_mu[i].Unlock()
+	}
+
+	// the names set is readonly, so copy it before removing the metric.
+	names, ok := db.names.Load().(*sset.Set)
+	if ok && names.Has(metric) {
+		names = names.Copy()
+		names.Remove(metric)
+		db.names.Store(names)
+	}
+}
+
+// dataFiles returns the paths to all of the data files in the directory for
+// every tier. It returns no paths if the directory does not exist.
+func dataFiles(dir string) (paths []string, err error) {
+	dh, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	defer dh.Close()
+
+	names, err := dh.Readdirnames(-1)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".data") {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths, nil
+}
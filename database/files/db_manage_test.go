@@ -0,0 +1,139 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/database"
+)
+
+// testMetricNames returns the names of all of the metrics in the db.
+func testMetricNames(t testing.TB, db *DB) (names []string) {
+	err := db.Metrics(ctx, func(name string) (bool, error) {
+		names = append(names, name)
+		return true, nil
+	})
+	assert.NoError(t, err)
+	return names
+}
+
+func TestDBManage(t *testing.T) {
+	newDB := func(t *testing.T) (*DB, func()) {
+		db, cleanup := newTestDB(t, Options{
+			Size:    1024,
+			Cap:     10,
+			Files:   10,
+			Rollups: []Rollup{{Resolution: 20}},
+		})
+		for i := int64(0); i < 30; i++ {
+			for _, metric := range []string{"a", "a.b", "c"} {
+				testWriteRecord(t, db, metric, 10*i, 10*i+10, float64(i))
+			}
+		}
+		assert.NoError(t, db.Rollup(ctx, 300))
+		return db, cleanup
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		assert.NoError(t, db.Delete(ctx, "a"))
+		assert.DeepEqual(t, testMetricNames(t, db), []string{"a.b", "c"})
+
+		// the nested metric is untouched
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "a.b")), 30)
+
+		// names populated from disk agree
+		assert.NoError(t, db.PopulateMetrics(ctx))
+		assert.DeepEqual(t, testMetricNames(t, db), []string{"a.b", "c"})
+
+		assert.Error(t, db.Delete(ctx, "a"))
+		assert.Error(t, db.Delete(ctx, "missing"))
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		assert.NoError(t, db.Rename(ctx, "c", "d.e"))
+		assert.DeepEqual(t, testMetricNames(t, db), []string{"a", "a.b", "d.e"})
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "d.e")), 30)
+
+		// the rollups move along with it. the last window is incomplete, so
+		// its records are read from the flushed records.
+		ctx := database.WithResolution(ctx, 20)
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "d.e")), 14+2)
+
+		assert.NoError(t, db.PopulateMetrics(ctx))
+		assert.DeepEqual(t, testMetricNames(t, db), []string{"a", "a.b", "d.e"})
+
+		assert.Error(t, db.Rename(ctx, "a", "a.b"))
+		assert.Error(t, db.Rename(ctx, "missing", "f"))
+	})
+
+	t.Run("Queued", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:   1024,
+			Cap:    10,
+			Files:  10,
+			Tuning: Tuning{Buffer: 10, Workers: 1},
+		})
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go db.Run(ctx)
+
+		run := func(t *testing.T, remove func(metric string) error,
+			names []string) {
+			testQueueValue(t, db, "queued", 0, 1)
+
+			// stall the worker on another metric so that the values for
+			// the metric are still queued when it is removed.
+			db.locks.Lock("stall")
+			testQueue := func(metric string, start int64) chan bool {
+				ch := make(chan bool, 1)
+				assert.NoError(t, db.Queue(ctx, metric, start, start+1,
+					testRecordData(t, start, start+1, 0),
+					func(ok bool, err error) { ch <- ok }))
+				return ch
+			}
+			stalled := testQueue("stall", 0)
+			queued := []chan bool{testQueue("queued", 1),
+				testQueue("queued", 2)}
+
+			assert.NoError(t, remove("queued"))
+			db.locks.Unlock("stall")
+
+			assert.That(t, <-stalled)
+			for _, ch := range queued {
+				assert.That(t, !<-ch)
+			}
+			assert.DeepEqual(t, testMetricNames(t, db), names)
+
+			// values queued after it was removed are written.
+			testQueueValue(t, db, "queued", 3, 4)
+			assert.Equal(t, len(testQueryRecords(t, db, ctx, "queued")), 1)
+
+			assert.NoError(t, db.Delete(ctx, "queued"))
+			assert.NoError(t, db.Delete(ctx, "stall"))
+		}
+
+		t.Run("Delete", func(t *testing.T) {
+			run(t, func(metric string) error {
+				return db.Delete(ctx, metric)
+			}, []string{"stall"})
+		})
+
+		t.Run("Rename", func(t *testing.T) {
+			run(t, func(metric string) error {
+				return db.Rename(ctx, metric, "renamed")
+			}, []string{"renamed", "stall"})
+			assert.Equal(t, len(testQueryRecords(t, db, ctx, "renamed")), 1)
+		})
+	})
+}
@@ -5,7 +5,10 @@ package files
 import (
 	"bytes"
 	"context"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/zeebo/rothko/database"
 	"github.com/zeebo/rothko/database/files/internal/sset"
@@ -16,20 +19,176 @@ import (
 // Query calls the ResultCallback with all of the data slices that end
 // strictly before the provided end time in strictly decreasing order by
 // their end. It will continue to call the ResultCallback until it exhausts
-// all of the records, or the callback returns false.
+// all of the records, or the callback returns false. If the context has a
+// resolution, records from the coarsest rollup tier with a resolution no
+// larger than it are used where they are available.
 func (db *DB) Query(ctx context.Context, metric string, end int64,
 	buf []byte, cb database.ResultCallback) error {
 
+	return db.QueryRange(ctx, metric, -1<<63, end, buf, cb)
+}
+
+// QueryRange is like Query, but only calls the ResultCallback with the data
+// slices that also end strictly after the provided start time. It uses the
+// metadata of the files to seek to the ones that contain them.
+func (db *DB) QueryRange(ctx context.Context, metric string, start, end int64,
+	buf []byte, cb database.ResultCallback) error {
+
 	db.locks.Lock(metric)
 	defer db.locks.Unlock(metric)
 
+	tier := db.queryTier(database.Resolution(ctx))
+	if tier > 0 {
+		return db.readTiers(ctx, metric, tier, start, end, buf, cb)
+	}
+
 	// acquire the datastructure encapsulating metric read logic
 	met, err := db.newMetric(ctx, metric, true)
 	if err != nil {
 		return err
 	}
 
-	return met.Read(ctx, end, buf, cb)
+	return met.ReadRange(ctx, start, end, buf, cb)
+}
+
+// queryTier returns the coarsest tier with a resolution no larger than the
+// resolution, or 0 for the flushed records.
+func (db *DB) queryTier(resolution time.Duration) (tier int) {
+	for i, rollup := range db.opts.Rollups {
+		if rollup.Resolution <= resolution {
+			tier = i + 1
+		}
+	}
+	return tier
+}
+
+// readTiers is like ReadRange on a metric, but reads from every tier up to and
+// including the provided tier. Each tier only provides the records that end
+// after the last record in the next tier, so that the most recent records
+// come from the finer tiers that have not been rolled up yet.
+func (db *DB) readTiers(ctx context.Context, name string, tier int,
+	start, end int64, buf []byte, cb database.ResultCallback) error {
+
+	mets := make([]*metric, tier+1)
+	for i := range mets {
+		met, err := db.newTierMetric(ctx, name, i, true)
+		if err != nil {
+			return err
+		}
+		mets[i] = met
+	}
+
+	for i, met := range mets {
+		// find the end of the next tier. everything at or before it is read
+		// from there instead.
+		boundary := int64(-1 << 63)
+		if i+1 < len(mets) {
+			_, last_end, _, err := mets[i+1].ReadLast(ctx, nil)
+			if err != nil {
+				return err
+			}
+			boundary = last_end
+		}
+
+		stopped := false
+		err := met.ReadRange(ctx, start, end, buf,
+			func(ctx context.Context, rec_start, rec_end int64,
+				data []byte) (bool, error) {
+
+				if rec_end <= boundary {
+					return false, nil
+				}
+				ok, err := cb(ctx, rec_start, rec_end, data)
+				stopped = !ok
+				return ok, err
+			})
+		if err != nil || stopped {
+			return err
+		}
+
+		if boundary < end {
+			end = boundary + 1
+		}
+		if end <= start {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// QueryBatch calls the BatchCallback with the data slices for every metric
+// that end strictly after the start time and strictly before the end time.
+// The metrics are read in parallel by up to the tuned number of query
+// workers, and the BatchCallback is never called concurrently. It returns
+// the first error from any metric.
+func (db *DB) QueryBatch(ctx context.Context, metrics []string,
+	start, end int64, cb database.BatchCallback) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := db.opts.Tuning.QueryWorkers
+	if workers > len(metrics) {
+		workers = len(metrics)
+	}
+
+	// cb_mu serializes the callbacks. the first error cancels the rest of
+	// the workers.
+	var cb_mu sync.Mutex
+	var err_once sync.Once
+	fail := func(ferr error) {
+		err_once.Do(func() {
+			err = ferr
+			cancel()
+		})
+	}
+
+	var next int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var buf []byte
+			for ctx.Err() == nil {
+				index := int(atomic.AddInt64(&next, 1) - 1)
+				if index >= len(metrics) {
+					return
+				}
+				metric := metrics[index]
+
+				qerr := db.QueryRange(ctx, metric, start, end, buf,
+					func(ctx context.Context, start, end int64,
+						data []byte) (bool, error) {
+
+						// keep the storage around for the next metric
+						buf = data[:0]
+
+						cb_mu.Lock()
+						defer cb_mu.Unlock()
+
+						if err := ctx.Err(); err != nil {
+							return false, err
+						}
+						return cb(ctx, metric, start, end, data)
+					})
+				if qerr != nil {
+					fail(qerr)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// if the context was canceled before the workers got to every metric,
+	// we didn't do the whole query.
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
 }
 
 // QueryLatest returns the latest value stored for the metric. buf is used
@@ -32,6 +32,76 @@ func TestDBRead(t *testing.T) {
 		assert.NoError(t, err)
 		assert.DeepEqual(t, names, expected)
 	})
+
+	t.Run("QueryRange", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:  1024,
+			Cap:   10,
+			Files: 10,
+		})
+		defer cleanup()
+
+		// write records every 10ns across many files
+		for i := int64(0); i < 50; i++ {
+			testWriteRecord(t, db, "metric", 10*i, 10*i+10, float64(i))
+		}
+
+		query := func(start, end int64) (ends []int64) {
+			err := db.QueryRange(ctx, "metric", start, end, nil,
+				func(ctx context.Context, start, end int64, buf []byte) (
+					bool, error) {
+
+					ends = append(ends, end)
+					return true, nil
+				})
+			assert.NoError(t, err)
+			return ends
+		}
+
+		assert.DeepEqual(t, query(195, 250), []int64{240, 230, 220, 210, 200})
+		assert.DeepEqual(t, query(0, 35), []int64{30, 20, 10})
+		assert.DeepEqual(t, query(480, 1000), []int64{500, 490})
+		assert.Equal(t, len(query(100, 100)), 0)
+		assert.Equal(t, len(query(-1<<63, 1<<63-1)), 50)
+	})
+
+	t.Run("QueryBatch", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:   1024,
+			Cap:    10,
+			Files:  10,
+			Tuning: Tuning{QueryWorkers: 4},
+		})
+		defer cleanup()
+
+		metrics := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+		for i := int64(0); i < 20; i++ {
+			for _, metric := range metrics {
+				testWriteRecord(t, db, metric, 10*i, 10*i+10, float64(i))
+			}
+		}
+
+		// every metric has its records in decreasing order
+		last := make(map[string]int64)
+		counts := make(map[string]int)
+		err := db.QueryBatch(ctx, metrics, 50, 150,
+			func(ctx context.Context, metric string, start, end int64,
+				buf []byte) (bool, error) {
+
+				if prev, ok := last[metric]; ok {
+					assert.That(t, end < prev)
+				}
+				last[metric] = end
+				counts[metric]++
+				return counts[metric] < 5, nil
+			})
+		assert.NoError(t, err)
+
+		for _, metric := range metrics {
+			assert.Equal(t, counts[metric], 5)
+			assert.Equal(t, last[metric], int64(100))
+		}
+	})
 }
 
 func BenchmarkDBRead(b *testing.B) {
@@ -4,6 +4,7 @@ package files
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/zeebo/rothko/database/files/internal/sset"
 )
@@ -42,6 +43,7 @@ func (db *DB) Queue(ctx context.Context, metric string, start int64,
 		end:    end,
 		data:   buf,
 		done:   cb,
+		seq:    atomic.AddUint64(&db.seq, 1),
 	}
 
 	if db.opts.Tuning.Drop {
@@ -62,19 +64,63 @@ func (db *DB) Queue(ctx context.Context, metric string, start int64,
 	return nil
 }
 
+// dispatch takes data from the queue and hands it to the worker for the
+// metric until the context is done. because every value for a metric goes to
+// the same worker in the order it was queued, values for a metric are
+// written in order, and none are rejected for being earlier than one that
+// was queued after them. if the worker's buffer is full, the value is
+// dropped when tuned to drop, and otherwise every worker waits on it.
+func (db *DB) dispatch(ctx context.Context, queue chan queuedValue,
+	shards []chan queuedValue) {
+
+	done := ctx.Done()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case value := <-queue:
+			shard := shards[shardOf(value.metric, len(shards))]
+
+			// a dropped value may already be logged. it is counted as
+			// written to the log, so it is lost once its segment is
+			// checkpointed.
+			if db.opts.Tuning.Drop {
+				select {
+				case shard <- value:
+				default:
+					db.abandon(value)
+				}
+				continue
+			}
+
+			select {
+			case shard <- value:
+			case <-done:
+				db.abandon(value)
+				return
+			}
+		}
+	}
+}
+
+// shardOf returns which of n workers writes the values for the metric, using
+// an fnv-1a hash of the name.
+func shardOf(metric string, n int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(metric); i++ {
+		hash ^= uint32(metric[i])
+		hash *= 16777619
+	}
+	return fastMod(hash, n)
+}
+
 // worker takes data from the queue and writes it into the appropriate metric
 // file in the appropriate location.
 func (db *DB) worker(ctx context.Context, num int, queue chan queuedValue) {
 	done := ctx.Done()
 
-	// NOTE(jeff): because there are multiple workers and because we do not
-	// allow writes for previous time points, there is a race where a value
-	// can be lost: when two workers are working on adding data for the same
-	// metric, but scheduled backwards from the insertion into the queue. we
-	// accept this risk because typically the queue will be empty before more
-	// values are inserted. it may be worth exposing knobs so that consumers
-	// can ensure the queue is empty, like perhaps a transactional style api.
-
 	for {
 		select {
 		case <-done:
@@ -82,6 +128,9 @@ func (db *DB) worker(ctx context.Context, num int, queue chan queuedValue) {
 
 		case value := <-queue:
 			ok, err := db.write(ctx, num, value)
+			if value.logged != nil {
+				value.logged.Done()
+			}
 			db.bufs.Put(value.data)
 			if value.done != nil {
 				value.done(ok, err)
@@ -90,6 +139,18 @@ func (db *DB) worker(ctx context.Context, num int, queue chan queuedValue) {
 	}
 }
 
+// abandon releases a value that will not be written, calling back that it
+// was not.
+func (db *DB) abandon(value queuedValue) {
+	if value.logged != nil {
+		value.logged.Done()
+	}
+	db.bufs.Put(value.data)
+	if value.done != nil {
+		value.done(false, nil)
+	}
+}
+
 // write puts the queued value into the appropriate file. it can be called
 // concurrently with other values, even when they reference the same metric.
 func (db *DB) write(ctx context.Context, num int, value queuedValue) (
@@ -99,6 +160,11 @@ func (db *DB) write(ctx context.Context, num int, value queuedValue) (
 	db.locks.Lock(value.metric)
 	defer db.locks.Unlock(value.metric)
 
+	// skip values queued before the metric was removed
+	if db.queuedBeforeRemove(value) {
+		return false, nil
+	}
+
 	// acquire the datastructure encapsulating metric write logic
 	met, err := db.newMetric(ctx, value.metric, false)
 	if err != nil {
@@ -5,8 +5,10 @@ package files
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/zeebo/assert"
 )
@@ -41,6 +43,189 @@ func TestDBWrite(t *testing.T) {
 	}
 }
 
+func TestDBWriteOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	db, cleanup := newTestDB(t, Options{
+		Size:  1024,
+		Cap:   100,
+		Files: 10,
+		Tuning: Tuning{
+			Buffer:  1000,
+			Workers: 8,
+		},
+	})
+	defer cleanup()
+	go db.Run(ctx)
+
+	type res struct {
+		b bool
+		e error
+	}
+
+	// queue a burst of values for a few metrics without waiting for any of
+	// them to be written. every one must be written.
+	const metrics, values = 4, 250
+	ch := make(chan res, metrics*values)
+	sendErr := func(ok bool, err error) { ch <- res{ok, err} }
+
+	for i := 0; i < values; i++ {
+		for j := 0; j < metrics; j++ {
+			db.Queue(ctx, fmt.Sprintf("test.order.%d", j), int64(i),
+				int64(i+1), make([]byte, 100), sendErr)
+		}
+	}
+
+	for i := 0; i < metrics*values; i++ {
+		r := <-ch
+		assert.That(t, r.b)
+		assert.NoError(t, r.e)
+	}
+
+	for j := 0; j < metrics; j++ {
+		count := 0
+		err := db.Query(ctx, fmt.Sprintf("test.order.%d", j), 1<<63-1, nil,
+			func(ctx context.Context, start, end int64, buf []byte) (
+				bool, error) {
+
+				count++
+				return true, nil
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, count, values)
+	}
+}
+
+func TestDBWriteDrop(t *testing.T) {
+	// find two metrics that are written by different workers.
+	slow, fast := "test.drop.slow", ""
+	for i := 0; fast == ""; i++ {
+		metric := fmt.Sprintf("test.drop.%d", i)
+		if shardOf(metric, 2) != shardOf(slow, 2) {
+			fast = metric
+		}
+	}
+
+	newDB := func(t *testing.T, wal bool) (*DB, func()) {
+		return newTestDB(t, Options{
+			Size:  1024,
+			Cap:   100,
+			Files: 10,
+			WAL:   wal,
+			Tuning: Tuning{
+				Buffer:  4,
+				Drop:    true,
+				Workers: 2,
+				WALSize: 4096,
+			},
+		})
+	}
+
+	// run starts the database, runs the function and stops the database.
+	run := func(t *testing.T, db *DB, fn func()) {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			db.Run(ctx)
+			close(done)
+		}()
+		fn()
+		cancel()
+		<-done
+	}
+
+	// drop holds the lock for the slow metric so that its worker is stuck,
+	// and queues more values for it than its worker can buffer. the values
+	// for the fast metric must still be written. it returns how many of the
+	// values for the slow metric were written.
+	const values = 20
+	drop := func(t *testing.T, db *DB) (written int) {
+		// only queue a value once the last one has been taken off of the
+		// queue so that none of them are dropped by Queue.
+		queue := db.queue.Load().(chan queuedValue)
+		queueValue := func(metric string, start int64, ch chan bool) {
+			for len(queue) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			assert.NoError(t, db.Queue(ctx, metric, start, start+1,
+				testRecordData(t, start, start+1, float64(start)),
+				func(ok bool, err error) { ch <- ok }))
+		}
+
+		fast_ch := make(chan bool, 1)
+		queueValue(fast, 0, fast_ch)
+		assert.That(t, <-fast_ch)
+
+		db.locks.Lock(slow)
+
+		slow_ch := make(chan bool, values)
+		for i := int64(0); i < values; i++ {
+			queueValue(slow, i, slow_ch)
+		}
+
+		queueValue(fast, 1, fast_ch)
+		assert.That(t, <-fast_ch)
+
+		db.locks.Unlock(slow)
+
+		for i := 0; i < values; i++ {
+			if <-slow_ch {
+				written++
+			}
+		}
+		assert.That(t, written > 0)
+		assert.That(t, written < values)
+		return written
+	}
+
+	t.Run("Workers", func(t *testing.T) {
+		db, cleanup := newDB(t, false)
+		defer cleanup()
+
+		run(t, db, func() { drop(t, db) })
+	})
+
+	t.Run("WAL", func(t *testing.T) {
+		db, cleanup := newDB(t, true)
+		defer cleanup()
+
+		// the values for the slow metric fit in a segment. write values for
+		// the fast metric until it is sealed and checkpointed.
+		var written int
+		run(t, db, func() {
+			written = drop(t, db)
+
+			dir := filepath.Join(db.dir, walDir)
+			nums, err := walSegments(dir)
+			assert.NoError(t, err)
+			last := nums[len(nums)-1]
+
+			for i := int64(2); nums[0] <= last; i++ {
+				testQueueValue(t, db, fast, i, i+1)
+				nums, err = walSegments(dir)
+				assert.NoError(t, err)
+			}
+		})
+
+		// the dropped values are not brought back by replaying the log.
+		run(t, db, func() {
+			testQueueValue(t, db, "other", 0, 1)
+		})
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, slow)), written)
+	})
+}
+
+func TestShardOf(t *testing.T) {
+	for n := 1; n < 10; n++ {
+		for _, metric := range []string{"", "a", "foo.bar", "foo.baz"} {
+			shard := shardOf(metric, n)
+			assert.That(t, shard >= 0 && shard < n)
+			assert.Equal(t, shardOf(metric, n), shard)
+		}
+	}
+}
+
 func BenchmarkDBWrite(b *testing.B) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -0,0 +1,502 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/rothko/database/files/internal/meta"
+)
+
+//
+// checking reads every data file into memory rather than through the file
+// cache so that files too broken to be opened can still be inspected. it is
+// meant to be done while the database is not running.
+//
+
+// Problem is an inconsistency found while checking the database.
+type Problem struct {
+	// Path is the file with the problem.
+	Path string
+
+	// Slot is the index of the record with the problem, or -1 if the
+	// problem is with the whole file.
+	Slot int
+
+	// Message describes the problem.
+	Message string
+
+	// Repaired is true if the file was rewritten to fix the problem.
+	Repaired bool
+}
+
+// String returns a human readable form of the problem.
+func (p Problem) String() string {
+	out := p.Path
+	if p.Slot >= 0 {
+		out += fmt.Sprintf(": slot %d", p.Slot)
+	}
+	out += ": " + p.Message
+	if p.Repaired {
+		out += " (repaired)"
+	}
+	return out
+}
+
+// Check validates the files of every metric in the database, including the
+// rollups. It checks that the files are numbered consecutively, that their
+// metadata and records are readable and agree, that multi part records are
+// complete, and that records are in order. If repair is true, files with
+// problems are rewritten to contain only the records that are intact and in
+// order, and gaps in the numbering are closed. The database must not be
+// running.
+func (db *DB) Check(ctx context.Context, repair bool) (
+	problems []Problem, err error) {
+
+	names, err := db.metricNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return problems, err
+		}
+		metric_problems, err := db.checkMetric(ctx, name, repair)
+		problems = append(problems, metric_problems...)
+		if err != nil {
+			return problems, err
+		}
+	}
+
+	return problems, nil
+}
+
+// metricNames returns the names of every metric on disk.
+func (db *DB) metricNames(ctx context.Context) (names []string, err error) {
+	if err := db.PopulateMetrics(ctx); err != nil {
+		return nil, err
+	}
+
+	err = db.Metrics(ctx, func(name string) (bool, error) {
+		names = append(names, name)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// checkMetric checks the files for every tier of the metric.
+func (db *DB) checkMetric(ctx context.Context, name string, repair bool) (
+	problems []Problem, err error) {
+
+	db.locks.Lock(name)
+	defer db.locks.Unlock(name)
+
+	dir := db.metricDir(name)
+	dh, err := os.Open(dir)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	entries, err := dh.Readdirnames(-1)
+	dh.Close()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	tiers := []string{""}
+	for _, rollup := range db.opts.Rollups {
+		tiers = append(tiers, rollup.tierName())
+	}
+
+	// find the indexes of the files for every tier, and any data files that
+	// don't belong to one.
+	indexes := make(map[string][]int, len(tiers))
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry, ".data") {
+			continue
+		}
+
+		found := false
+		for _, tier := range tiers {
+			index, ok := parseDataName(entry, tier)
+			if ok {
+				indexes[tier] = append(indexes[tier], index)
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, Problem{
+				Path:    filepath.Join(dir, entry),
+				Slot:    -1,
+				Message: "data file with an unknown name",
+			})
+		}
+	}
+
+	var fb filenameBuf
+	for _, tier := range tiers {
+		nums := indexes[tier]
+		sort.Ints(nums)
+
+		// every file between the first and last must exist for reads to
+		// work. close any gaps by renumbering the later files.
+		for i := 1; i < len(nums); i++ {
+			if nums[i] == nums[i-1]+1 {
+				continue
+			}
+
+			path := fb.metricFilenameAt(dir, nums[i-1]+1, tier)
+			problems = append(problems, Problem{
+				Path:     path,
+				Slot:     -1,
+				Message:  "missing data file",
+				Repaired: repair,
+			})
+			if !repair {
+				continue
+			}
+
+			from := fb.metricFilenameAt(dir, nums[i], tier)
+			db.fch.evictFile(from)
+			if err := os.Rename(from, path); err != nil {
+				return problems, Error.Wrap(err)
+			}
+			nums[i] = nums[i-1] + 1
+		}
+
+		// check all of the files in order, keeping track of the last end
+		// so that we can tell if records are out of order across files.
+		last_end := int64(-1 << 63)
+		for _, num := range nums {
+			path := fb.metricFilenameAt(dir, num, tier)
+			file_problems, err := db.checkFile(ctx, path, &last_end, repair)
+			problems = append(problems, file_problems...)
+			if err != nil {
+				return problems, err
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// fsckValue is a value recovered from the records of a file.
+type fsckValue struct {
+	start, end int64
+	flags      recordFlags
+	data       []byte
+}
+
+// fsckScan is the result of scanning the records of a file.
+type fsckScan struct {
+	size     int
+	capacity int
+	md       meta.Metadata
+	md_ok    bool
+	old      bool // true if any record is older than recordVersion
+
+	// values are the values that are intact, latest first.
+	values []fsckValue
+}
+
+// checkFile checks the records of the file at the path, and rewrites it if
+// it has any problems and repair is true. last_end is the end of the latest
+// record in the previous files, and is updated with the records in this one.
+func (db *DB) checkFile(ctx context.Context, path string, last_end *int64,
+	repair bool) (problems []Problem, err error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	scan, problems := db.scanFile(path, data)
+	if scan.capacity < 1 {
+		return problems, nil
+	}
+
+	// the values are latest first, so flip them around and make sure they
+	// are in order with each other and the previous files.
+	values := scan.values
+	for i := 0; i < len(values)/2; i++ {
+		si := len(values) - 1 - i
+		values[i], values[si] = values[si], values[i]
+	}
+	ordered := values[:0]
+	for _, value := range values {
+		if value.end <= *last_end || value.end < value.start {
+			problems = append(problems, Problem{
+				Path: path,
+				Slot: -1,
+				Message: fmt.Sprintf("record [%d, %d) out of order",
+					value.start, value.end),
+			})
+			continue
+		}
+		ordered = append(ordered, value)
+		*last_end = value.end
+	}
+	values = ordered
+
+	// compare the metadata to the records
+	md := scan.md
+	expected := fsckMetadata(scan.size, scan.capacity, values)
+	if scan.md_ok && (md.Start != expected.Start ||
+		md.End != expected.End ||
+		md.SmallestEnd != expected.SmallestEnd) {
+
+		problems = append(problems, Problem{
+			Path:    path,
+			Slot:    -1,
+			Message: "metadata does not match records",
+		})
+	}
+
+	if len(problems) == 0 || !repair {
+		return problems, nil
+	}
+
+	db.fch.evictFile(path)
+	err = rewriteFile(path, scan.size, scan.capacity, values)
+	if err != nil {
+		return problems, err
+	}
+	for i := range problems {
+		problems[i].Repaired = true
+	}
+	return problems, nil
+}
+
+// scanFile reads the metadata and the values out of the data of the file at
+// the path, returning any problems with them. If the capacity of the scan is
+// less than one, the records could not be found at all.
+func (db *DB) scanFile(path string, data []byte) (
+	scan fsckScan, problems []Problem) {
+
+	problem := func(slot int, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Path:    path,
+			Slot:    slot,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// figure out the size of the records from the metadata, falling back to
+	// the configured size if it's broken.
+	scan.size = db.opts.Size
+	md, md_err := readMetadata(data)
+	switch {
+	case md_err != nil:
+		problem(-1, "unreadable metadata: %v", md_err)
+	case md.Size_ < recordHeaderSize:
+		problem(-1, "invalid record size in metadata: %d", md.Size_)
+	default:
+		scan.size, scan.md, scan.md_ok = md.Size_, md, true
+		scan.old = data[0] != recordVersion
+	}
+	if scan.size < recordHeaderSize {
+		problem(-1, "invalid record size: %d", scan.size)
+		return scan, problems
+	}
+	if len(data)%scan.size != 0 {
+		problem(-1, "length %d is not a multiple of the record size %d",
+			len(data), scan.size)
+	}
+	scan.capacity = len(data)/scan.size - 1
+	if scan.capacity < 1 {
+		problem(-1, "file too small to hold any records")
+		return scan, problems
+	}
+
+	// walk the records from the start of the data, which is the latest,
+	// collecting the values that are intact.
+	var chain []record
+	chain_slot := 0
+	started := false
+
+	for slot := 0; slot < scan.capacity; slot++ {
+		buf := data[(slot+1)*scan.size : (slot+2)*scan.size]
+
+		// only the slots before the first record should be empty
+		if buf[0] == 0 {
+			if started {
+				problem(slot, "empty slot between records")
+			}
+			continue
+		}
+		started = true
+
+		rec, err := readRecord(buf)
+		if err != nil {
+			problem(slot, "unreadable record: %v", err)
+			chain = chain[:0]
+			continue
+		}
+		if rec.version != recordVersion {
+			scan.old = true
+		}
+
+		// if we are in a chain, everything until the end must belong to it.
+		if len(chain) > 0 && (rec.kind == recordKind_complete ||
+			rec.kind == recordKind_begin ||
+			rec.start != chain[0].start || rec.end != chain[0].end ||
+			rec.flags != chain[0].flags) {
+
+			problem(chain_slot, "incomplete multi part record")
+			chain = chain[:0]
+		}
+
+		switch rec.kind {
+		case recordKind_complete:
+			scan.values = append(scan.values, fsckValue{
+				start: rec.start,
+				end:   rec.end,
+				flags: rec.flags,
+				data:  rec.data,
+			})
+
+		case recordKind_begin:
+			chain = append(chain[:0], rec)
+			chain_slot = slot
+
+		case recordKind_continue:
+			if len(chain) == 0 {
+				problem(slot, "multi part record without a beginning")
+				break
+			}
+			chain = append(chain, rec)
+
+		case recordKind_end:
+			if len(chain) == 0 {
+				problem(slot, "multi part record without a beginning")
+				break
+			}
+			value := fsckValue{
+				start: rec.start,
+				end:   rec.end,
+				flags: rec.flags,
+			}
+			for _, part := range append(chain, rec) {
+				value.data = append(value.data, part.data...)
+			}
+			scan.values = append(scan.values, value)
+			chain = chain[:0]
+
+		default:
+			problem(slot, "invalid record kind: %d", rec.kind)
+		}
+	}
+	if len(chain) > 0 {
+		problem(chain_slot, "incomplete multi part record")
+	}
+
+	// make sure that the compressed values can be decompressed
+	var inflated []byte
+	intact := scan.values[:0]
+	for _, value := range scan.values {
+		if value.flags&recordFlags_deflate != 0 {
+			var err error
+			inflated, err = inflate(inflated[:0], value.data)
+			if err != nil {
+				problem(-1, "record [%d, %d) does not decompress: %v",
+					value.start, value.end, err)
+				continue
+			}
+		}
+		intact = append(intact, value)
+	}
+	scan.values = intact
+
+	return scan, problems
+}
+
+// fsckMetadata returns the metadata for a file containing the values, where
+// the values are in increasing order.
+func fsckMetadata(size, capacity int, values []fsckValue) (
+	m meta.Metadata) {
+
+	m.Size_ = size
+	m.Head = capacity - 1
+	for _, value := range values {
+		m.Head -= numRecords(len(value.data), size)
+	}
+	if len(values) > 0 {
+		m.Start = values[0].start
+		m.End = values[len(values)-1].end
+		m.SmallestEnd = values[0].end
+	}
+	return m
+}
+
+// rewriteFile replaces the file at the path with one containing the values,
+// laid out just as if they had been written in order.
+func rewriteFile(path string, size, capacity int, values []fsckValue) (
+	err error) {
+
+	data := make([]byte, size*(capacity+1))
+	m := fsckMetadata(size, capacity, values)
+	if err := writeMetadata(data[:size], m); err != nil {
+		return err
+	}
+
+	head := capacity
+	for _, value := range values {
+		head -= numRecords(len(value.data), size)
+		slot := head
+		err := iterateRecords(value.start, value.end, value.flags,
+			value.data, size, func(rec record) error {
+				off := (slot + 1) * size
+				slot++
+				return writeRecord(data[off:off+size], rec)
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp := path + ".fsck"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return Error.Wrap(err)
+	}
+	return Error.Wrap(os.Rename(tmp, path))
+}
+
+// parseDataName returns the index of the data file with the name if it
+// belongs to the tier.
+func parseDataName(name, tier string) (index int, ok bool) {
+	suffix := tierSuffix(tier)
+	if !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	val, err := strconv.ParseInt(name[:len(name)-len(suffix)], 10, 0)
+	if err != nil || val <= 0 {
+		return 0, false
+	}
+	return int(val), true
+}
+
+// Dump writes a description of every file and record for the metric to w.
+func (db *DB) Dump(ctx context.Context, metric string, w io.Writer) (
+	err error) {
+
+	db.locks.Lock(metric)
+	defer db.locks.Unlock(metric)
+
+	m, err := db.newMetric(ctx, metric, true)
+	if err != nil {
+		return err
+	}
+	return m.dump(ctx, w)
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestCheck(t *testing.T) {
+	newDB := func(t *testing.T, size int) (*DB, func()) {
+		db, cleanup := newTestDB(t, Options{
+			Size:  size,
+			Cap:   10,
+			Files: 10,
+		})
+		for i := int64(1); i <= 25; i++ {
+			testWriteRecord(t, db, "metric", i, i+1, float64(i))
+		}
+		db.fch.Close()
+		return db, cleanup
+	}
+
+	// modify changes the bytes of the nth data file for the metric.
+	modify := func(t *testing.T, db *DB, n int, fn func(data []byte)) {
+		var fb filenameBuf
+		path := fb.metricFilenameAt(db.metricDir("metric"), n, "")
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		fn(data)
+		assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	}
+
+	// check runs a check, then a repair, and then ensures a check finds no
+	// more problems.
+	check := func(t *testing.T, db *DB) (problems []Problem) {
+		problems, err := db.Check(ctx, false)
+		assert.NoError(t, err)
+		for _, problem := range problems {
+			t.Log(problem)
+			assert.That(t, !problem.Repaired)
+		}
+
+		repaired, err := db.Check(ctx, true)
+		assert.NoError(t, err)
+		assert.Equal(t, len(repaired), len(problems))
+		for _, problem := range repaired {
+			assert.That(t, problem.Repaired)
+		}
+
+		after, err := db.Check(ctx, false)
+		assert.NoError(t, err)
+		assert.Equal(t, len(after), 0)
+
+		return problems
+	}
+
+	t.Run("Clean", func(t *testing.T) {
+		db, cleanup := newDB(t, 1024)
+		defer cleanup()
+
+		problems, err := db.Check(ctx, false)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		db, cleanup := newDB(t, 1024)
+		defer cleanup()
+
+		// flip a byte in the data of the last record in the first file
+		modify(t, db, 1, func(data []byte) {
+			data[1024+recordHeaderSize] ^= 0xff
+		})
+
+		problems := check(t, db)
+		assert.Equal(t, len(problems), 2) // the record and the metadata
+		assert.Equal(t, problems[0].Slot, 0)
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 24)
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		// small records so that every value needs multiple parts
+		db, cleanup := newDB(t, 64)
+		defer cleanup()
+
+		// break the first part of the latest record in the first file
+		modify(t, db, 1, func(data []byte) {
+			for slot := 0; ; slot++ {
+				if off := (slot + 1) * 64; data[off] != 0 {
+					data[off+recordHeaderSize] ^= 0xff
+					return
+				}
+			}
+		})
+
+		problems := check(t, db)
+		assert.That(t, len(problems) > 0)
+		recs := testQueryRecords(t, db, ctx, "metric")
+		assert.That(t, len(recs) > 0 && len(recs) < 25)
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		db, cleanup := newDB(t, 1024)
+		defer cleanup()
+
+		// swap the first file with the second so the times go backwards
+		var fb filenameBuf
+		dir := db.metricDir("metric")
+		first := fb.metricFilenameAt(dir, 1, "")
+		second := fb.metricFilenameAt(dir, 2, "")
+		assert.NoError(t, os.Rename(first, first+".tmp"))
+		assert.NoError(t, os.Rename(second, first))
+		assert.NoError(t, os.Rename(first+".tmp", second))
+
+		problems := check(t, db)
+		assert.Equal(t, len(problems), 11) // the records and the metadata
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		db, cleanup := newDB(t, 1024)
+		defer cleanup()
+
+		var fb filenameBuf
+		dir := db.metricDir("metric")
+		assert.NoError(t, os.Remove(fb.metricFilenameAt(dir, 2, "")))
+
+		problems := check(t, db)
+		assert.Equal(t, len(problems), 1)
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 15)
+	})
+}
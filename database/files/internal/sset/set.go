@@ -51,6 +51,26 @@ func (s *Set) Add(x string) {
 	s.order[i] = x
 }
 
+// Remove removes the key from the set if it is present.
+func (s *Set) Remove(x string) {
+	if _, ok := s.set[x]; !ok {
+		return
+	}
+	delete(s.set, x)
+
+	// find the index of x and remove it
+	i, j := 0, len(s.order)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if s.order[h] < x {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	s.order = append(s.order[:i], s.order[i+1:]...)
+}
+
 // Copy returns a copy of the set.
 func (s *Set) Copy() *Set {
 	// TODO(jeff): is it pathalogical to add the keys in sorted order or hash
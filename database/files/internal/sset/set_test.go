@@ -43,6 +43,20 @@ func TestSet(t *testing.T) {
 		assert.That(t, !s.Has("y"))
 	})
 
+	t.Run("Remove", func(t *testing.T) {
+		s := New(0)
+
+		s.Add("z")
+		s.Add("y")
+		s.Add("x")
+		s.Remove("y")
+		s.Remove("w")
+
+		assert.DeepEqual(t, collect(s), []string{"x", "z"})
+		assert.That(t, !s.Has("y"))
+		assert.Equal(t, s.Len(), 2)
+	})
+
 	t.Run("Merge", func(t *testing.T) {
 		a, b := New(0), New(0)
 
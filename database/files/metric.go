@@ -35,17 +35,30 @@ type metricOptions struct {
 	dir  string
 	name string
 	max  int
-	ro   bool // read only
+	ro   bool   // read only
+	tier string // name of the rollup tier, empty for flushed records
+
+	compress bool // compress values written with deflate
+}
+
+// tierSuffix returns the suffix of the data files for the tier.
+func tierSuffix(tier string) string {
+	if tier == "" {
+		return ".data"
+	}
+	return "." + tier + ".data"
 }
 
 // filenameBuf is a cache around constructing paths, as it is a significant
 // source of allocations.
 type filenameBuf []byte
 
-// metricFilenameAt returns the data file for the index.
-func (fb *filenameBuf) metricFilenameAt(dir string, index int) string {
+// metricFilenameAt returns the data file for the index in the tier.
+func (fb *filenameBuf) metricFilenameAt(dir string, index int,
+	tier string) string {
+
 	out := []byte(*fb)[:0]
-	if initial := len(dir) + 12; cap(out) < initial {
+	if initial := len(dir) + len(tier) + 13; cap(out) < initial {
 		out = make([]byte, 0, initial)
 	}
 
@@ -54,6 +67,10 @@ func (fb *filenameBuf) metricFilenameAt(dir string, index int) string {
 		out = append(out, '/')
 	}
 	out = strconv.AppendInt(out, int64(index), 10)
+	if tier != "" {
+		out = append(out, '.')
+		out = append(out, tier...)
+	}
 	out = append(out, ".data"...)
 
 	*fb = filenameBuf(out)
@@ -112,19 +129,24 @@ func newMetric(ctx context.Context, opts metricOptions) (*metric, error) {
 	// compute the first and last metric files for the metric. if first == last
 	// then we know there was at most one file. if last == 0, we know there
 	// are zero files.
+	//
+	// the files for other tiers have a different suffix, and the files for
+	// flushed records are skipped when looking at a tier because their index
+	// fails to parse.
 	first, last := 0, 0
 	first_set := false
+	suffix := tierSuffix(opts.tier)
 	for _, name := range names {
-		if !strings.HasSuffix(name, ".data") {
+		if !strings.HasSuffix(name, suffix) {
 			continue
 		}
 
-		val, err := strconv.ParseInt(name[:len(name)-5], 10, 0)
+		val, err := strconv.ParseInt(name[:len(name)-len(suffix)], 10, 0)
 		if err != nil {
 			continue
 		}
 		iv := int(val)
-		interned[iv] = fb.metricFilenameAt(dir, iv)
+		interned[iv] = fb.metricFilenameAt(dir, iv, opts.tier)
 
 		if iv > last {
 			last = iv
@@ -139,7 +161,7 @@ func newMetric(ctx context.Context, opts metricOptions) (*metric, error) {
 	// the logic because we can from now on assume that at least one possibly
 	// empty file exists.
 	if !first_set {
-		path := fb.metricFilenameAt(dir, 1)
+		path := fb.metricFilenameAt(dir, 1, opts.tier)
 		f, err := opts.fch.acquireFile(ctx, path, false)
 		if err != nil {
 			return nil, err
@@ -165,7 +187,7 @@ func (m *metric) filenameAt(index int) string {
 	if path, ok := m.interned[index]; ok {
 		return path
 	}
-	path := m.fb.metricFilenameAt(m.dir, index)
+	path := m.fb.metricFilenameAt(m.dir, index, m.opts.tier)
 	m.interned[index] = path
 	return path
 }
@@ -218,6 +240,22 @@ func (m *metric) acquireLast(ctx context.Context) (f file, head int,
 func (m *metric) Write(ctx context.Context, start, end int64, data []byte) (
 	ok bool, err error) {
 
+	// compress the data if it helps, keeping the compressor around until the
+	// records are written.
+	var flags recordFlags
+	if m.opts.compress {
+		c := compressors.Get().(*compressor)
+		defer compressors.Put(c)
+
+		compressed, err := c.Compress(data)
+		if err != nil {
+			return false, err
+		}
+		if len(compressed) < len(data) {
+			data, flags = compressed, recordFlags_deflate
+		}
+	}
+
 	// acquire the last file and determine where the head pointer is for it.
 	f, head, err := m.acquireLast(ctx)
 	if err != nil {
@@ -228,13 +266,16 @@ func (m *metric) Write(ctx context.Context, start, end int64, data []byte) (
 	// point head at the first valid record (or out of bounds at the capacity)
 	head++
 
-	// if the last file has a record, ensure monotonicity with it.
+	// if the last file has a record, ensure monotonicity with it. if the
+	// record can't be read, like when a crash tore it, it is skipped when
+	// reading, so we can write after it.
 	if f.HasRecord(ctx, head) {
 		last_rec, err := f.Record(ctx, head)
 		if err != nil {
-			return false, err
-		}
-		if last_rec.end >= end {
+			external.Errorw("error reading last record",
+				"err", err,
+			)
+		} else if last_rec.end >= end {
 			return false, nil
 		}
 	}
@@ -295,7 +336,7 @@ func (m *metric) Write(ctx context.Context, start, end int64, data []byte) (
 	new_head := head - 1
 
 	// write the records into the file
-	err = iterateRecords(start, end, data, f.Size(),
+	err = iterateRecords(start, end, flags, data, f.Size(),
 		func(rec record) error {
 			err := f.SetRecord(ctx, head, rec)
 			head++
@@ -328,6 +369,64 @@ func (m *metric) Write(ctx context.Context, start, end int64, data []byte) (
 	return true, nil
 }
 
+// Sync causes the files that may contain records that start at or after
+// start to be synced to disk.
+func (m *metric) Sync(ctx context.Context, start int64) (err error) {
+	for num := m.last; num >= m.first; num-- {
+		path := m.filenameAt(num)
+		f, err := m.opts.fch.acquireFile(ctx, path, true)
+		if err != nil {
+			return err
+		}
+		meta, err := f.Metadata(ctx)
+		if err == nil {
+			err = f.FullSync(ctx)
+		}
+		m.opts.fch.releaseFile(path, f)
+		if err != nil {
+			return err
+		}
+
+		// earlier files only have records from before this one started
+		if meta.Start != 0 && meta.Start < start {
+			break
+		}
+	}
+	return nil
+}
+
+// Trim removes files that only contain data that ends before the cutoff. It
+// never removes the last file. It returns how many files were removed. This
+// method is not safe to be called concurrently.
+func (m *metric) Trim(ctx context.Context, cutoff int64) (
+	removed int, err error) {
+
+	for m.first < m.last {
+		path := m.filenameAt(m.first)
+		f, err := m.opts.fch.acquireFile(ctx, path, true)
+		if err != nil {
+			return removed, err
+		}
+		meta, err := f.Metadata(ctx)
+		m.opts.fch.releaseFile(path, f)
+		if err != nil {
+			return removed, err
+		}
+		if meta.End >= cutoff {
+			break
+		}
+
+		m.opts.fch.evictFile(path)
+		if err := os.Remove(path); err != nil {
+			return removed, Error.Wrap(err)
+		}
+		m.first++
+		removed++
+	}
+
+	return removed, nil
+}
+
 // Read returns all of the writes that are strictly before end. it appends the
 // data to the provided buf and runs the provided callback. the data slice is
 // reused between callback calls, so callers must ensure they do not keep
@@ -338,13 +437,39 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 	cb func(ctx context.Context, start, end int64, data []byte) (
 		bool, error)) error {
 
+	return m.ReadRange(ctx, -1<<63, end, buf, cb)
+}
+
+// ReadRange is like Read, but only returns the writes that also end strictly
+// after start.
+func (m *metric) ReadRange(ctx context.Context, start, end int64,
+	buf []byte, cb func(ctx context.Context, start, end int64, data []byte) (
+		bool, error)) error {
+
 	// since we expect most queries to be for the most recent data, we do a
-	// simple strategy that optimizes for sequential reads: we start at the
-	// last file, use the metadata per file to skip ones that are unlikely to
-	// contain any data, and then linerally walk until we have records to call
-	// back.
+	// simple strategy that optimizes for sequential reads: we seek to the
+	// last file that could have data before the end, use the metadata per
+	// file to skip ones that are unlikely to contain any data, and then
+	// linerally walk until we have records to call back or the files are
+	// entirely before the start.
 
-	for num := m.last; num >= m.first; num-- {
+	last, err := m.seek(ctx, end)
+	if err != nil {
+		return err
+	}
+
+	// decode returns the data of the value that ends with the record, which
+	// has been collected into buf, decompressing it if necessary.
+	var inflated []byte
+	decode := func(rec record) (data []byte, err error) {
+		if rec.flags&recordFlags_deflate == 0 {
+			return buf, nil
+		}
+		inflated, err = inflate(inflated[:0], buf)
+		return inflated, err
+	}
+
+	for num := last; num >= m.first; num-- {
 		ok, err := func() (ok bool, err error) {
 			// load up the file at num so that we can start reading records.
 			path := m.filenameAt(num)
@@ -360,6 +485,9 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 				return false, err
 			}
 			if meta.SmallestEnd >= end {
+				return true, nil
+			}
+			if meta.End != 0 && meta.End <= start {
 				return false, nil
 			}
 
@@ -395,7 +523,7 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 				// if the record ends after the end time, we can skip it. we
 				// dont need to check elsewhere because every other record
 				// must have the same timestamps.
-				if rec.end >= end {
+				if rec.end >= end || rec.end <= start {
 					continue new_record
 				}
 
@@ -407,7 +535,16 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 				// if we have a complete record, bump the head pointer and
 				// move to the next record.
 				if rec.kind == recordKind_complete {
-					ok, err := cb(ctx, rec.start, rec.end, buf)
+					data, err := decode(rec)
+					if err != nil {
+						// drop any records we can't decompress
+						external.Errorw("error decompressing record",
+							"err", err,
+						)
+						continue new_record
+					}
+
+					ok, err := cb(ctx, rec.start, rec.end, data)
 					if err != nil {
 						return false, err
 					}
@@ -464,7 +601,16 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 
 					// ok we're done with that value, callback and move on to
 					// the next value.
-					ok, err = cb(ctx, rec.start, rec.end, buf)
+					data, err := decode(rec)
+					if err != nil {
+						// drop any records we can't decompress
+						external.Errorw("error decompressing record",
+							"err", err,
+						)
+						continue new_record
+					}
+
+					ok, err = cb(ctx, rec.start, rec.end, data)
 					if err != nil {
 						return false, err
 					}
@@ -494,6 +640,33 @@ func (m *metric) Read(ctx context.Context, end int64, buf []byte,
 	return nil
 }
 
+// seek returns the last file that starts before end. because the files are
+// written in order, no later file can contain data that ends before end.
+func (m *metric) seek(ctx context.Context, end int64) (num int, err error) {
+	lo, hi := m.first, m.last
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+
+		path := m.filenameAt(mid)
+		f, err := m.opts.fch.acquireFile(ctx, path, true)
+		if err != nil {
+			return 0, err
+		}
+		meta, err := f.Metadata(ctx)
+		m.opts.fch.releaseFile(path, f)
+		if err != nil {
+			return 0, err
+		}
+
+		if meta.Start < end {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo, nil
+}
+
 // ReadLast reads the last value out of the metric. buf is used as storage for
 // the data slice if possible. Returns 0, 0, nil, nil if there is no data.
 func (m *metric) ReadLast(ctx context.Context, buf []byte) (
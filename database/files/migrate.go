@@ -0,0 +1,103 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+)
+
+// Migrate rewrites every data file, including the rollups, that contains
+// records older than the version this package writes. The values are split
+// into records again for the new header, so a full file may grow by a few
+// records to keep all of them. Files with problems are not migrated and are
+// returned so that they can be repaired with Check first. The database must
+// not be running.
+func (db *DB) Migrate(ctx context.Context) (
+	migrated []string, problems []Problem, err error) {
+
+	names, err := db.metricNames(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return migrated, problems, err
+		}
+		metric_migrated, metric_problems, err := db.migrateMetric(ctx, name)
+		migrated = append(migrated, metric_migrated...)
+		problems = append(problems, metric_problems...)
+		if err != nil {
+			return migrated, problems, err
+		}
+	}
+
+	return migrated, problems, nil
+}
+
+// migrateMetric migrates the data files of every tier of the metric.
+func (db *DB) migrateMetric(ctx context.Context, name string) (
+	migrated []string, problems []Problem, err error) {
+
+	db.locks.Lock(name)
+	defer db.locks.Unlock(name)
+
+	paths, err := dataFiles(db.metricDir(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		ok, file_problems, err := db.migrateFile(path)
+		problems = append(problems, file_problems...)
+		if err != nil {
+			return migrated, problems, err
+		}
+		if ok {
+			migrated = append(migrated, path)
+		}
+	}
+
+	return migrated, problems, nil
+}
+
+// migrateFile rewrites the file at the path with the current record version
+// if it needs it and has no problems. It returns true if it was rewritten.
+func (db *DB) migrateFile(path string) (
+	ok bool, problems []Problem, err error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, nil, Error.Wrap(err)
+	}
+
+	scan, problems := db.scanFile(path, data)
+	if len(problems) > 0 || !scan.old {
+		return false, problems, nil
+	}
+
+	// the values are latest first, but are written in order. make sure there
+	// is room for all of them with the new header.
+	values := scan.values
+	needed := 0
+	for i := 0; i < len(values)/2; i++ {
+		si := len(values) - 1 - i
+		values[i], values[si] = values[si], values[i]
+	}
+	for _, value := range values {
+		needed += numRecords(len(value.data), scan.size)
+	}
+	capacity := scan.capacity
+	if needed > capacity {
+		capacity = needed
+	}
+
+	db.fch.evictFile(path)
+	if err := rewriteFile(path, scan.size, capacity, values); err != nil {
+		return false, nil, err
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/database/files/internal/meta"
+)
+
+func TestMigrate(t *testing.T) {
+	// downgrade rewrites every record in the file as a version 1 record in
+	// the same slot.
+	downgrade := func(t *testing.T, path string, size int) {
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		for off := 0; off < len(data); off += size {
+			buf := data[off : off+size]
+			if buf[0] == 0 {
+				continue
+			}
+			rec, err := parse(buf)
+			assert.NoError(t, err)
+			rec.version = 1
+			rec.Copy(nil)
+			for i := range buf {
+				buf[i] = 0
+			}
+			assert.NoError(t, writeRecord(buf, rec))
+		}
+		assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	}
+
+	// versions returns the set of record versions in the file.
+	versions := func(t *testing.T, path string, size int) map[int8]bool {
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		out := make(map[int8]bool)
+		for off := 0; off < len(data); off += size {
+			if data[off] != 0 {
+				out[int8(data[off])] = true
+			}
+		}
+		return out
+	}
+
+	t.Run("Metric", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:  64,
+			Cap:   10,
+			Files: 10,
+		})
+		defer cleanup()
+
+		for i := int64(1); i <= 25; i++ {
+			testWriteRecord(t, db, "metric", i, i+1, float64(i))
+		}
+		db.fch.Close()
+
+		paths, err := dataFiles(db.metricDir("metric"))
+		assert.NoError(t, err)
+		for _, path := range paths {
+			downgrade(t, path, 64)
+			assert.DeepEqual(t, versions(t, path, 64), map[int8]bool{1: true})
+		}
+
+		// version 1 files are still readable
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 25)
+		db.fch.Close()
+
+		migrated, problems, err := db.Migrate(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+		assert.Equal(t, len(migrated), len(paths))
+
+		for _, path := range paths {
+			assert.DeepEqual(t, versions(t, path, 64), map[int8]bool{2: true})
+		}
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 25)
+
+		problems, err = db.Check(ctx, false)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+
+		// nothing is left to migrate
+		migrated, problems, err = db.Migrate(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+		assert.Equal(t, len(migrated), 0)
+	})
+
+	t.Run("Grow", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{Size: 64})
+		defer cleanup()
+
+		// a full file with one record that uses all of the space a version
+		// 1 header leaves, which needs two records with the new header.
+		size := 64
+		value := bytes.Repeat([]byte{1}, size-recordHeaderSizeV1)
+		data := make([]byte, size*2)
+		assert.NoError(t, writeMetadata(data[:size], meta.Metadata{
+			Size_:       size,
+			Head:        -1,
+			Start:       1,
+			End:         2,
+			SmallestEnd: 2,
+		}))
+		assert.NoError(t, writeRecord(data[size:], record{
+			version: 1,
+			kind:    recordKind_complete,
+			start:   1,
+			end:     2,
+			size:    uint16(len(value)),
+			data:    value,
+		}))
+		path := filepath.Join(db.dir, "1.data")
+		assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+		downgrade(t, path, size)
+
+		ok, problems, err := db.migrateFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, len(problems), 0)
+		assert.That(t, ok)
+
+		data, err = ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		scan, problems := db.scanFile(path, data)
+		assert.Equal(t, len(problems), 0)
+		assert.That(t, !scan.old)
+		assert.Equal(t, scan.capacity, 2)
+		assert.Equal(t, len(scan.values), 1)
+		assert.DeepEqual(t, scan.values[0].data, value)
+	})
+}
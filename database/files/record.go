@@ -7,16 +7,18 @@ import (
 	"hash/crc32"
 )
 
-// we use castagnoli for the crc checksum for version 2 and above
+// we use castagnoli for the crc checksum for version 2 and above. version 1
+// records were also always written with it, so it is used for them too.
 var castTable = crc32.MakeTable(crc32.Castagnoli)
 
 // recordVersion is the version of records this package will write.
-const recordVersion = 1
+const recordVersion = 2
 
 // record represents an individual record inside of a circular buffer file.
 type record struct {
 	version int8
 	kind    recordKind
+	flags   recordFlags
 	start   int64
 	end     int64
 	size    uint16
@@ -24,9 +26,44 @@ type record struct {
 }
 
 // recordHeaderSize is the size of the record, without the data field, but
-// with a crc at the end. sizeof makes this tricky to compute, so we just
-// manually add.
-const recordHeaderSize = (1 + 1 + 8 + 8 + 2) + 4
+// with a crc at the end, for the version this package writes. sizeof makes
+// this tricky to compute, so we just manually add.
+const recordHeaderSize = recordHeaderSizeV2
+
+// recordHeaderSizeV1 is the size of a version 1 record header. it has the
+// version, kind, start, end, size and crc.
+const recordHeaderSizeV1 = (1 + 1 + 8 + 8 + 2) + 4
+
+// recordHeaderSizeV2 is the size of a version 2 record header. it adds a
+// byte of flags after the kind.
+const recordHeaderSizeV2 = (1 + 1 + 1 + 8 + 8 + 2) + 4
+
+// headerSize returns the size of the record header for the version, or 0 if
+// the version is unknown.
+func headerSize(version int8) int {
+	switch version {
+	case 1:
+		return recordHeaderSizeV1
+	case 2:
+		return recordHeaderSizeV2
+	default:
+		return 0
+	}
+}
+
+// recordFlags is a set of flags describing how a record is stored. version 1
+// records never have any flags.
+type recordFlags uint8
+
+const (
+	// the data of the value the record is part of is compressed with
+	// deflate. every record of the value has the flag.
+	recordFlags_deflate recordFlags = 1 << iota
+)
+
+// recordFlags_all is every flag this package understands. records with any
+// other flags cannot be read.
+const recordFlags_all = recordFlags_deflate
 
 // recordKind is an enumeration of kinds of records.
 type recordKind int8
@@ -50,7 +87,7 @@ const (
 
 // Size returns the marshalled size of the record.
 func (r record) Size() int {
-	return recordHeaderSize + int(r.size)
+	return headerSize(r.version) + int(r.size)
 }
 
 // Copy copies the data using the backing array of the passed in buf.
@@ -58,7 +95,9 @@ func (r *record) Copy(buf []byte) {
 	r.data = append(buf[:0], r.data...)
 }
 
-// MarshalHeader writes a record header to the provided buf, returning it.
+// MarshalHeader writes a record header to the provided buf, returning it. The
+// layout of the header depends on the version of the record, which must be
+// known.
 func (r record) MarshalHeader(buf []byte) []byte {
 	// resize buf once if necessary
 	if size := r.Size(); cap(buf) < size {
@@ -66,20 +105,26 @@ func (r record) MarshalHeader(buf []byte) []byte {
 	}
 
 	// help out bounds checking
-	buf = buf[:recordHeaderSize]
+	header_size := headerSize(r.version)
+	buf = buf[:header_size]
 
 	buf[0] = uint8(r.version)
 	buf[1] = uint8(r.kind)
-	binary.BigEndian.PutUint64(buf[2:10], uint64(r.start))
-	binary.BigEndian.PutUint64(buf[10:18], uint64(r.end))
-	binary.BigEndian.PutUint16(buf[18:20], r.size)
+	fields := buf[2:]
+	if r.version >= 2 {
+		buf[2] = uint8(r.flags)
+		fields = buf[3:]
+	}
+	binary.BigEndian.PutUint64(fields[0:8], uint64(r.start))
+	binary.BigEndian.PutUint64(fields[8:16], uint64(r.end))
+	binary.BigEndian.PutUint16(fields[16:18], r.size)
 
 	// the crc is everything but the last 4 bytes of the record header followed
 	// by the data.
 	var crc uint32
-	crc = crc32.Update(crc, castTable, buf[:recordHeaderSize-4])
+	crc = crc32.Update(crc, castTable, buf[:header_size-4])
 	crc = crc32.Update(crc, castTable, r.data[:r.size])
-	binary.BigEndian.PutUint32(buf[20:24], crc)
+	binary.BigEndian.PutUint32(fields[18:22], crc)
 
 	return buf
 }
@@ -91,38 +136,52 @@ func (r record) Marshal(buf []byte) []byte {
 	return buf
 }
 
-// parse reads a record out of the byte slice. it returns an error if there is
-// not enough data to be a full record.
+// parse reads a record of any known version out of the byte slice. it returns
+// an error if there is not enough data to be a full record.
 func parse(buf []byte) (out record, err error) {
-	if len(buf) < recordHeaderSize {
+	if len(buf) < 1 {
 		return out, Error.New("record buf not big enough for header")
 	}
 
 	out.version = int8(buf[0])
-	if out.version != recordVersion {
+	header_size := headerSize(out.version)
+	if header_size == 0 {
 		return out, Error.New("unknown record header version: %d", out.version)
 	}
+	if len(buf) < header_size {
+		return out, Error.New("record buf not big enough for header")
+	}
 
 	out.kind = recordKind(buf[1])
-	out.start = int64(binary.BigEndian.Uint64(buf[2:10]))
-	out.end = int64(binary.BigEndian.Uint64(buf[10:18]))
-	out.size = binary.BigEndian.Uint16(buf[18:20])
+	fields := buf[2:]
+	if out.version >= 2 {
+		out.flags = recordFlags(buf[2])
+		fields = buf[3:]
+	}
+	out.start = int64(binary.BigEndian.Uint64(fields[0:8]))
+	out.end = int64(binary.BigEndian.Uint64(fields[8:16]))
+	out.size = binary.BigEndian.Uint16(fields[16:18])
 
-	data_end := recordHeaderSize + int(out.size)
+	data_end := header_size + int(out.size)
 	if len(buf) < data_end {
 		return out, Error.New("record buf not big enough for data")
 	}
-	out.data = buf[recordHeaderSize:data_end]
+	out.data = buf[header_size:data_end]
 
 	// the crc is everything but the last 4 bytes of the record header
 	// followed by the data.
 	var crc uint32
-	crc = crc32.Update(crc, castTable, buf[:recordHeaderSize-4])
+	crc = crc32.Update(crc, castTable, buf[:header_size-4])
 	crc = crc32.Update(crc, castTable, out.data)
-	if disk_crc := binary.BigEndian.Uint32(buf[20:24]); crc != disk_crc {
+	if disk_crc := binary.BigEndian.Uint32(fields[18:22]); crc != disk_crc {
 		return out, Error.New("crc mismatch: %x != disk %x", crc, disk_crc)
 	}
 
+	// check the flags only once we know they aren't corrupt
+	if unknown := out.flags &^ recordFlags_all; unknown != 0 {
+		return out, Error.New("unknown record flags: %x", uint8(unknown))
+	}
+
 	return out, nil
 }
 
@@ -140,11 +199,11 @@ func numRecords(len, size int) int {
 }
 
 // iterateRecords chunks up the data into individual records whose marshalled
-// size is at most size. The records are passed to the callback function.
-// If the function returns an error, the iteration stops. Errors if size is not
-// inside of a range to produce valid records.
-func iterateRecords(start, end int64, data []byte, size int,
-	fn func(rec record) error) error {
+// size is at most size, all with the flags. The records are passed to the
+// callback function. If the function returns an error, the iteration stops.
+// Errors if size is not inside of a range to produce valid records.
+func iterateRecords(start, end int64, flags recordFlags, data []byte,
+	size int, fn func(rec record) error) error {
 
 	chunk := size - recordHeaderSize
 	if chunk < 0 || int(uint16(chunk)) != chunk {
@@ -158,6 +217,7 @@ func iterateRecords(start, end int64, data []byte, size int,
 		err := fn(record{
 			version: recordVersion,
 			kind:    kind,
+			flags:   flags,
 			start:   start,
 			end:     end,
 			size:    uint16(chunk),
@@ -180,6 +240,7 @@ func iterateRecords(start, end int64, data []byte, size int,
 	return fn(record{
 		version: recordVersion,
 		kind:    kind,
+		flags:   flags,
 		start:   start,
 		end:     end,
 		size:    uint16(len(data)),
@@ -18,7 +18,7 @@ func TestRecords(t *testing.T) {
 	t.Run("Complete", func(t *testing.T) {
 		var out []record
 
-		err := iterateRecords(1234, 5678, data, 1024, func(rec record) error {
+		err := iterateRecords(1234, 5678, 0, data, 1024, func(rec record) error {
 			out = append(out, rec)
 			return nil
 		})
@@ -64,10 +64,46 @@ func TestRecords(t *testing.T) {
 		}
 	})
 
+	t.Run("Version1", func(t *testing.T) {
+		rec := record{
+			version: 1,
+			kind:    recordKind_complete,
+			start:   1234,
+			end:     5678,
+			size:    100,
+			data:    data,
+		}
+		out := rec.Marshal(nil)
+		assert.Equal(t, len(out), recordHeaderSizeV1+100)
+
+		got, err := parse(out)
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, rec)
+
+		out[len(out)-1]++
+		_, err = parse(out)
+		assert.Error(t, err)
+	})
+
+	t.Run("Flags", func(t *testing.T) {
+		rec := record{
+			version: recordVersion,
+			kind:    recordKind_complete,
+			flags:   0x80,
+			start:   1234,
+			end:     5678,
+			size:    100,
+			data:    data,
+		}
+		_, err := parse(rec.Marshal(nil))
+		assert.Error(t, err)
+	})
+
 	t.Run("Split", func(t *testing.T) {
 		var out []record
 
-		err := iterateRecords(1234, 5678, data, 54, func(rec record) error {
+		size := recordHeaderSize + 30
+		err := iterateRecords(1234, 5678, 0, data, size, func(rec record) error {
 			out = append(out, rec)
 			return nil
 		})
@@ -107,10 +143,10 @@ func TestRecords(t *testing.T) {
 			data:    data[90:100],
 		})
 
-		assert.Equal(t, len(out[0].Marshal(nil)), 54)
-		assert.Equal(t, len(out[1].Marshal(nil)), 54)
-		assert.Equal(t, len(out[2].Marshal(nil)), 54)
-		assert.That(t, len(out[3].Marshal(nil)) <= 54)
+		assert.Equal(t, len(out[0].Marshal(nil)), size)
+		assert.Equal(t, len(out[1].Marshal(nil)), size)
+		assert.Equal(t, len(out[2].Marshal(nil)), size)
+		assert.That(t, len(out[3].Marshal(nil)) <= size)
 	})
 }
 
@@ -147,7 +183,7 @@ func BenchmarkRecords(b *testing.B) {
 		b.ReportAllocs()
 
 		for i := 0; i < b.N; i++ {
-			iterateRecords(1234, 5678, data, 1024, func(rec record) error {
+			iterateRecords(1234, 5678, 0, data, 1024, func(rec record) error {
 				return nil
 			})
 		}
@@ -157,7 +193,7 @@ func BenchmarkRecords(b *testing.B) {
 		b.ReportAllocs()
 
 		for i := 0; i < b.N; i++ {
-			iterateRecords(1234, 5678, data, 50, func(rec record) error {
+			iterateRecords(1234, 5678, 0, data, 50, func(rec record) error {
 				return nil
 			})
 		}
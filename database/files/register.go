@@ -4,6 +4,7 @@ package files
 
 import (
 	"context"
+	"time"
 
 	"github.com/zeebo/rothko/database"
 	"github.com/zeebo/rothko/internal/typeassert"
@@ -19,17 +20,49 @@ func init() {
 				Size:  int(a.I("size").Int64()),
 				Cap:   int(a.I("cap").Int64()),
 				Files: int(a.I("files").Int64()),
+
+				Retention: a.I("retention").Duration(),
+				Idle:      a.I("idle").Duration(),
+				WAL:       a.I("wal").Bool(),
+				Compress:  a.I("compress").Bool(),
+
 				Tuning: Tuning{
 					Buffer:  int(a.I("tuning").I("buffer").Int64()),
 					Drop:    a.I("tuning").I("drop").Bool(),
 					Handles: int(a.I("tuning").I("handles").Int64()),
 					Workers: int(a.I("tuning").I("workers").Int64()),
+
+					QueryWorkers: int(a.I("tuning").
+						I("query_workers").Int64()),
+					WALSize: a.I("tuning").I("wal_size").Int64(),
+
+					RollupInterval: a.I("tuning").I("rollup_interval").Duration(),
+					RetentionInterval: a.I("tuning").
+						I("retention_interval").Duration(),
 				},
 			}
+			for i := 0; i < a.I("rollups").Len(); i++ {
+				rollup := a.I("rollups").N(i)
+				opts.Rollups = append(opts.Rollups, Rollup{
+					Resolution: rollup.I("resolution").Duration(),
+					Retention:  rollup.I("retention").Duration(),
+				})
+			}
 			if err := a.Err(); err != nil {
 				return nil, err
 			}
 
+			// rollups must get coarser so that each can be built from the
+			// previous one.
+			var last time.Duration
+			for _, rollup := range opts.Rollups {
+				if rollup.Resolution <= last {
+					return nil, Error.New("rollup resolutions must be "+
+						"positive and increasing: %v", rollup.Resolution)
+				}
+				last = rollup.Resolution
+			}
+
 			return New(dir, opts), nil
 		}))
 }
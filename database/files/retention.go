@@ -0,0 +1,109 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeebo/rothko/external"
+	"github.com/zeebo/errs"
+)
+
+// runRetention removes files past the retention and idle metrics
+// periodically until the context is done.
+func (db *DB) runRetention(ctx context.Context) {
+	ticker := time.NewTicker(db.opts.Tuning.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := db.Expire(ctx, time.Now().UnixNano())
+		if err != nil && ctx.Err() == nil {
+			external.Errorw("removing expired files",
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// Expire removes the files of every metric that only contain records that
+// ended before the retention as of now, and deletes every metric whose latest
+// record ended before the idle time as of now. The latest file of a metric
+// is only removed when the metric is deleted.
+func (db *DB) Expire(ctx context.Context, now int64) (err error) {
+	if db.opts.Retention <= 0 && db.opts.Idle <= 0 {
+		return nil
+	}
+
+	var names []string
+	err = db.Metrics(ctx, func(name string) (bool, error) {
+		names = append(names, name)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var group errs.Group
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		group.Add(db.expireMetric(ctx, name, now))
+	}
+	return group.Err()
+}
+
+// expireMetric deletes the metric if it is idle, and otherwise removes the
+// files for it that are past the retention.
+func (db *DB) expireMetric(ctx context.Context, name string, now int64) (
+	err error) {
+
+	// deleting an idle metric is logged, which needs the log locked first.
+	if db.opts.Idle > 0 {
+		unlock := db.lockWAL()
+		defer unlock()
+	}
+
+	db.locks.Lock(name)
+	defer db.locks.Unlock(name)
+
+	m, err := db.newMetric(ctx, name, false)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Idle > 0 {
+		_, end, _, err := m.ReadLast(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if end < now-db.opts.Idle.Nanoseconds() {
+			external.Infow("deleting idle metric",
+				"metric", name,
+				"last", end,
+			)
+			return db.deleteMetric(ctx, name)
+		}
+	}
+
+	if db.opts.Retention > 0 {
+		cutoff := now - db.opts.Retention.Nanoseconds()
+		removed, err := m.Trim(ctx, cutoff)
+		if removed > 0 {
+			external.Infow("removed expired files",
+				"metric", name,
+				"files", removed,
+			)
+		}
+		return err
+	}
+
+	return nil
+}
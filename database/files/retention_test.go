@@ -0,0 +1,63 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestExpire(t *testing.T) {
+	db, cleanup := newTestDB(t, Options{
+		Size:      1024,
+		Cap:       10,
+		Retention: 500,
+	})
+	defer cleanup()
+
+	for i := int64(0); i < 100; i++ {
+		testWriteRecord(t, db, "metric", 10*i, 10*i+10, float64(i))
+	}
+
+	// nothing is removed before the cutoff passes any file
+	assert.NoError(t, db.Expire(ctx, 500))
+	assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 100)
+
+	// only whole files that end before 500 are removed, so the earliest
+	// remaining record ends somewhere after the first and no later than the
+	// cutoff.
+	assert.NoError(t, db.Expire(ctx, 1000))
+	recs := testQueryRecords(t, db, ctx, "metric")
+	earliest := recs[len(recs)-1].EndTime
+	assert.That(t, earliest > 10)
+	assert.That(t, earliest <= 500)
+	assert.Equal(t, recs[0].EndTime, int64(1000))
+
+	// the latest file is always kept
+	assert.NoError(t, db.Expire(ctx, 1<<62))
+	recs = testQueryRecords(t, db, ctx, "metric")
+	assert.That(t, len(recs) > 0)
+	assert.Equal(t, recs[0].EndTime, int64(1000))
+}
+
+func TestExpireIdle(t *testing.T) {
+	db, cleanup := newTestDB(t, Options{
+		Size: 1024,
+		Cap:  10,
+		Idle: 100,
+	})
+	defer cleanup()
+
+	for i := int64(0); i < 10; i++ {
+		testWriteRecord(t, db, "old", 10*i, 10*i+10, float64(i))
+		testWriteRecord(t, db, "new", 10*i+100, 10*i+110, float64(i))
+	}
+
+	assert.NoError(t, db.Expire(ctx, 200))
+	assert.DeepEqual(t, testMetricNames(t, db), []string{"new", "old"})
+
+	assert.NoError(t, db.Expire(ctx, 201))
+	assert.DeepEqual(t, testMetricNames(t, db), []string{"new"})
+	assert.Equal(t, len(testQueryRecords(t, db, ctx, "new")), 10)
+}
@@ -0,0 +1,185 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/external"
+	"github.com/zeebo/rothko/merge"
+	"github.com/zeebo/errs"
+)
+
+//
+// rollups are tiers of coarser records stored next to the flushed records of
+// a metric, in files with the name of the tier before the extension. each
+// tier is built from the records of the previous tier by merging all of the
+// records that start in a window of the resolution. a window is only rolled
+// up once a record starts after it, so that every record that belongs in it
+// has been written.
+//
+
+// runRollups builds the rollup tiers periodically until the context is done.
+func (db *DB) runRollups(ctx context.Context) {
+	ticker := time.NewTicker(db.opts.Tuning.RollupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := db.Rollup(ctx, time.Now().UnixNano())
+		if err != nil && ctx.Err() == nil {
+			external.Errorw("building rollups",
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// Rollup builds the rollup tiers of every metric from all of the complete
+// windows of records in the previous tiers, and removes rolled up records
+// that are older than the retention of their tier as of now.
+func (db *DB) Rollup(ctx context.Context, now int64) (err error) {
+	var names []string
+	err = db.Metrics(ctx, func(name string) (bool, error) {
+		names = append(names, name)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var group errs.Group
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		group.Add(db.rollupMetric(ctx, name, now))
+	}
+	return group.Err()
+}
+
+// rollupMetric builds all of the rollup tiers for the metric.
+func (db *DB) rollupMetric(ctx context.Context, name string, now int64) (
+	err error) {
+
+	db.locks.Lock(name)
+	defer db.locks.Unlock(name)
+
+	for tier := 1; tier <= len(db.opts.Rollups); tier++ {
+		if err := db.rollupTier(ctx, name, tier, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupTier builds the tier for the metric from the records in the previous
+// tier that end after the last record in it.
+func (db *DB) rollupTier(ctx context.Context, name string, tier int,
+	now int64) (err error) {
+
+	rollup := db.opts.Rollups[tier-1]
+	resolution := rollup.Resolution.Nanoseconds()
+
+	src, err := db.newTierMetric(ctx, name, tier-1, true)
+	if err != nil {
+		return err
+	}
+	dst, err := db.newTierMetric(ctx, name, tier, false)
+	if err != nil {
+		return err
+	}
+
+	// find where the tier left off
+	_, last_end, _, err := dst.ReadLast(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// collect the records after that. they are read latest first, so flip
+	// them around once we have them all.
+	var recs []data.Record
+	err = src.ReadRange(ctx, last_end, 1<<63-1, nil,
+		func(ctx context.Context, start, end int64, buf []byte) (
+			bool, error) {
+
+			var rec data.Record
+			if err := rec.Unmarshal(buf); err != nil {
+				// skip any records we can't understand
+				external.Errorw("error unmarshaling record",
+					"metric", name,
+					"err", err,
+				)
+				return true, nil
+			}
+			recs = append(recs, rec)
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(recs)/2; i++ {
+		si := len(recs) - 1 - i
+		recs[i], recs[si] = recs[si], recs[i]
+	}
+
+	// window returns the start of the window the record belongs in. records
+	// that start before the last rolled up record are put in the window
+	// after it.
+	window := func(rec data.Record) int64 {
+		start := rec.StartTime
+		if start < last_end {
+			start = last_end
+		}
+		offset := start % resolution
+		if offset < 0 {
+			offset += resolution
+		}
+		return start - offset
+	}
+
+	// merge every complete window and write it into the tier
+	for len(recs) > 0 {
+		start, n := window(recs[0]), 1
+		for n < len(recs) && window(recs[n]) == start {
+			n++
+		}
+		if n == len(recs) {
+			break
+		}
+
+		rec, err := merge.Merge(ctx, merge.MergeOptions{
+			Records: recs[:n],
+		})
+		if err != nil {
+			return err
+		}
+		buf, err := rec.Marshal()
+		if err != nil {
+			return Error.Wrap(err)
+		}
+		_, err = dst.Write(ctx, rec.StartTime, rec.EndTime, buf)
+		if err != nil {
+			return err
+		}
+
+		recs = recs[n:]
+	}
+
+	// clean up anything past the retention
+	if rollup.Retention > 0 {
+		_, err := dst.Trim(ctx, now-rollup.Retention.Nanoseconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
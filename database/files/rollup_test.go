@@ -0,0 +1,161 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/database"
+	"github.com/zeebo/rothko/dist/tdigest"
+)
+
+// testRecordData returns a marshaled record with one observation of val.
+func testRecordData(t testing.TB, start, end int64, val float64) []byte {
+	d, err := tdigest.Params{Compression: 5}.New()
+	assert.NoError(t, err)
+	d.Observe(val)
+
+	buf, err := (&data.Record{
+		StartTime:    start,
+		EndTime:      end,
+		Observations: 1,
+		Distribution: d.Marshal(nil),
+		Kind:         d.Kind(),
+		Merged:       1,
+		Min:          val,
+		Max:          val,
+	}).Marshal()
+	assert.NoError(t, err)
+	return buf
+}
+
+// testWriteRecord synchronously writes a record with one observation of val
+// for the metric.
+func testWriteRecord(t testing.TB, db *DB, metric string, start, end int64,
+	val float64) {
+
+	ok, err := db.write(ctx, 0, queuedValue{
+		metric: metric,
+		start:  start,
+		end:    end,
+		data:   testRecordData(t, start, end, val),
+	})
+	assert.NoError(t, err)
+	assert.That(t, ok)
+}
+
+// testQueryRecords returns all of the records for the metric.
+func testQueryRecords(t testing.TB, db *DB, ctx context.Context,
+	metric string) (recs []data.Record) {
+
+	err := db.Query(ctx, metric, 1<<63-1, nil,
+		func(ctx context.Context, start, end int64, buf []byte) (
+			bool, error) {
+
+			var rec data.Record
+			assert.NoError(t, rec.Unmarshal(buf))
+			assert.Equal(t, rec.StartTime, start)
+			assert.Equal(t, rec.EndTime, end)
+			recs = append(recs, rec)
+			return true, nil
+		})
+	assert.NoError(t, err)
+	return recs
+}
+
+func TestRollup(t *testing.T) {
+	db, cleanup := newTestDB(t, Options{
+		Size:  1024,
+		Cap:   10,
+		Files: 100,
+		Rollups: []Rollup{
+			{Resolution: 10},
+			{Resolution: 100},
+		},
+	})
+	defer cleanup()
+
+	// write records every 2ns for 200ns
+	for i := int64(0); i < 100; i++ {
+		testWriteRecord(t, db, "metric", 2*i, 2*i+2, float64(i))
+	}
+	assert.NoError(t, db.Rollup(ctx, 200))
+
+	query := func(resolution time.Duration) (ends []int64, obs int64) {
+		ctx := database.WithResolution(ctx, resolution)
+		for _, rec := range testQueryRecords(t, db, ctx, "metric") {
+			ends = append(ends, rec.EndTime)
+			obs += rec.Observations
+		}
+		return ends, obs
+	}
+
+	t.Run("Flushed", func(t *testing.T) {
+		ends, obs := query(0)
+		assert.Equal(t, len(ends), 100)
+		assert.Equal(t, obs, int64(100))
+	})
+
+	t.Run("Tier", func(t *testing.T) {
+		// the last window is not complete, so it comes from the flushed
+		// records.
+		ends, obs := query(10)
+		assert.DeepEqual(t, ends, []int64{
+			200, 198, 196, 194, 192,
+			190, 180, 170, 160, 150, 140, 130, 120, 110, 100,
+			90, 80, 70, 60, 50, 40, 30, 20, 10,
+		})
+		assert.Equal(t, obs, int64(100))
+	})
+
+	t.Run("Stitched", func(t *testing.T) {
+		ends, obs := query(time.Hour)
+		assert.DeepEqual(t, ends, []int64{
+			200, 198, 196, 194, 192,
+			190, 180, 170, 160, 150, 140, 130, 120, 110,
+			100,
+		})
+		assert.Equal(t, obs, int64(100))
+	})
+
+	t.Run("Incremental", func(t *testing.T) {
+		// completing the last window rolls it up without duplicating any
+		// of the earlier windows.
+		testWriteRecord(t, db, "metric", 200, 202, 100)
+		assert.NoError(t, db.Rollup(ctx, 202))
+
+		ends, obs := query(10)
+		assert.DeepEqual(t, ends[:3], []int64{202, 200, 190})
+		assert.Equal(t, len(ends), 21)
+		assert.Equal(t, obs, int64(101))
+	})
+}
+
+func TestRollupRetention(t *testing.T) {
+	db, cleanup := newTestDB(t, Options{
+		Size:    1024,
+		Cap:     10,
+		Files:   100,
+		Rollups: []Rollup{{Resolution: 10, Retention: 500}},
+	})
+	defer cleanup()
+
+	for i := int64(0); i < 100; i++ {
+		testWriteRecord(t, db, "metric", 10*i, 10*i+10, float64(i))
+	}
+	assert.NoError(t, db.Rollup(ctx, 1000))
+
+	// only whole files of rollups that end before 500 are removed, so the
+	// earliest remaining rollup ends somewhere after the first and no later
+	// than the cutoff.
+	recs := testQueryRecords(t, db, database.WithResolution(ctx, 10),
+		"metric")
+	earliest := recs[len(recs)-1].EndTime
+	assert.That(t, earliest > 10)
+	assert.That(t, earliest <= 500)
+	assert.Equal(t, recs[0].EndTime, int64(1000))
+}
@@ -0,0 +1,714 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zeebo/rothko/external"
+	"github.com/zeebo/errs"
+)
+
+//
+// the write-ahead log is a sequence of numbered segment files in a directory
+// that no metric can map to. every queued value is appended to the current
+// segment and the segment is fsynced in batches before the values are handed
+// to the workers. once a segment is larger than the tuned size, it is sealed
+// and a new one is started. a sealed segment is removed once all of the
+// values in it have been written and the files for the metrics in it have
+// been synced to disk.
+//
+// on startup, all of the values in the segments are written again. values
+// that are already in the files are skipped because every write must be
+// later than the last one for the metric.
+//
+// deleting or renaming a metric appends a tombstone to the log before it
+// happens, so that replaying the values logged before it does not bring the
+// metric back under its old name. tombstones are replayed in order with the
+// values.
+//
+
+// walDir is the name of the directory holding the write-ahead log. metric
+// names always escape percent signs, so no metric can use it.
+const walDir = "%wal"
+
+// walSuffix is the extension of the segment files.
+const walSuffix = ".wal"
+
+// walBatch is the most values appended to the log for one fsync.
+const walBatch = 1024
+
+// walHeaderSize is the size of the length and crc before every entry.
+const walHeaderSize = 4 + 4
+
+// walKind is the kind of an entry in the write-ahead log.
+type walKind uint8
+
+const (
+	// a value to write to a metric
+	walKind_value walKind = iota
+
+	// a tombstone for deleting a metric
+	walKind_delete
+
+	// a tombstone for renaming a metric
+	walKind_rename
+)
+
+// walEntry is an entry in the write-ahead log. Every entry has the metric in
+// the value, and values also have the times and data. Renames have the new
+// name of the metric in to.
+type walEntry struct {
+	kind  walKind
+	value queuedValue
+	to    string
+}
+
+// walSegment is a file in the write-ahead log.
+type walSegment struct {
+	num  int
+	path string
+	fh   *os.File
+	buf  *bufio.Writer
+	size int64
+
+	// broken is set if the segment could not be rolled back after a failed
+	// append, so nothing more should be appended to it.
+	broken bool
+
+	// starts has the earliest start logged for every metric in the segment,
+	// and pending counts the values logged that have not been written.
+	starts  map[string]int64
+	pending sync.WaitGroup
+}
+
+// wal appends queued values to the segments of the write-ahead log. mu
+// protects the current segment, which tombstones are appended to while the
+// values are being logged.
+type wal struct {
+	db     *DB
+	dir    string
+	sealed chan *walSegment
+
+	mu    sync.Mutex
+	seg   *walSegment
+	entry []byte
+}
+
+// openWAL writes all of the values left in the write-ahead log into the
+// database, removes the segments, and returns a wal ready to log values.
+func (db *DB) openWAL(ctx context.Context) (w *wal, err error) {
+	dir := filepath.Join(db.dir, walDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	nums, err := walSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// write every value in the log, keeping track of the earliest start of
+	// every metric so that their files can be synced.
+	starts := make(map[string]int64)
+	next := 1
+	for _, num := range nums {
+		path := walPath(dir, num)
+		replayed, err := db.replayWAL(ctx, path, starts)
+		if err != nil {
+			return nil, err
+		}
+		external.Infow("replayed write-ahead log",
+			"path", path,
+			"values", replayed,
+		)
+		next = num + 1
+	}
+
+	if err := db.syncMetrics(ctx, starts); err != nil {
+		return nil, err
+	}
+	for _, num := range nums {
+		if err := os.Remove(walPath(dir, num)); err != nil {
+			return nil, Error.Wrap(err)
+		}
+	}
+
+	w = &wal{
+		db:     db,
+		dir:    dir,
+		sealed: make(chan *walSegment, 1),
+	}
+	if err := w.openSegment(next); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// replayWAL writes every value and applies every tombstone in the segment
+// at the path. A torn entry at the end of the segment, from a crash while
+// appending, ends the replay.
+func (db *DB) replayWAL(ctx context.Context, path string,
+	starts map[string]int64) (replayed int, err error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+
+	for len(data) > 0 {
+		entry, rem, ok := parseWALEntry(data)
+		if !ok {
+			external.Errorw("torn write-ahead log entry",
+				"path", path,
+				"remaining", len(data),
+			)
+			break
+		}
+		data = rem
+
+		value := entry.value
+		switch entry.kind {
+		case walKind_delete:
+			err = db.replayDelete(value.metric)
+
+		case walKind_rename:
+			err = db.replayRename(value.metric, entry.to)
+
+			// the values for the old name are now in the files for the new
+			// name, so those need to be synced.
+			if start, ok := starts[value.metric]; ok {
+				if to_start, ok := starts[entry.to]; !ok || start < to_start {
+					starts[entry.to] = start
+				}
+			}
+
+		default:
+			_, err = db.write(ctx, 0, value)
+			if err == nil {
+				if start, ok := starts[value.metric]; !ok ||
+					value.start < start {
+
+					starts[value.metric] = value.start
+				}
+			}
+		}
+		if err != nil {
+			// drop any entries we can't apply, just like the workers do
+			external.Errorw("error replaying write-ahead log entry",
+				"metric", value.metric,
+				"err", err,
+			)
+			continue
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// replayDelete removes the data files of the metric, if there are any.
+func (db *DB) replayDelete(metric string) (err error) {
+	db.locks.Lock(metric)
+	defer db.locks.Unlock(metric)
+
+	dir := db.metricDir(metric)
+	paths, err := dataFiles(dir)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	return db.removeFiles(metric, dir, paths)
+}
+
+// replayRename moves the data files of the metric named from to the metric
+// named to, if there are any. The rename may have already happened, so the
+// files the metric named to already has are kept, because the values that
+// were replayed for the metric named from are already in them.
+func (db *DB) replayRename(from, to string) (err error) {
+	if from == to {
+		return nil
+	}
+
+	unlock := db.lockPair(from, to)
+	defer unlock()
+
+	paths, err := dataFiles(db.metricDir(from))
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	return db.moveFiles(from, to, paths)
+}
+
+// syncMetrics syncs the files of every metric that may contain records that
+// start at or after the start.
+func (db *DB) syncMetrics(ctx context.Context,
+	starts map[string]int64) (err error) {
+
+	var group errs.Group
+	for name, start := range starts {
+		group.Add(db.syncMetric(ctx, name, start))
+	}
+	return group.Err()
+}
+
+// syncMetric syncs the files of the metric that may contain records that
+// start at or after the start.
+func (db *DB) syncMetric(ctx context.Context, name string,
+	start int64) (err error) {
+
+	db.locks.Lock(name)
+	defer db.locks.Unlock(name)
+
+	// the metric may have been deleted since it was written
+	paths, err := dataFiles(db.metricDir(name))
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+
+	m, err := db.newMetric(ctx, name, true)
+	if err != nil {
+		return err
+	}
+	return m.Sync(ctx, start)
+}
+
+// lockWAL locks the write-ahead log so that a tombstone can be logged, and
+// returns a function to unlock it. It must be called before locking any
+// metrics, and does nothing if there is no log.
+func (db *DB) lockWAL() func() {
+	if !db.opts.WAL {
+		return func() {}
+	}
+	db.wal_mu.Lock()
+	return db.wal_mu.Unlock
+}
+
+// logTombstone appends the entry to the write-ahead log, if there is one. It
+// must be called with the log locked. If the database is not running, any
+// segments left in the log are replayed on the next startup, so the entry is
+// written to a new segment after them.
+func (db *DB) logTombstone(entry walEntry) (err error) {
+	if !db.opts.WAL {
+		return nil
+	}
+	if db.wal != nil {
+		return db.wal.tombstone(entry)
+	}
+
+	dir := filepath.Join(db.dir, walDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	nums, err := walSegments(dir)
+	if err != nil || len(nums) == 0 {
+		return err
+	}
+
+	path := walPath(dir, nums[len(nums)-1]+1)
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, Error.Wrap(fh.Close())) }()
+
+	if _, err := fh.Write(appendWALEntry(nil, entry)); err != nil {
+		return Error.Wrap(err)
+	}
+	return Error.Wrap(fh.Sync())
+}
+
+// openSegment starts appending to a new segment with the number.
+func (w *wal) openSegment(num int) (err error) {
+	path := walPath(w.dir, num)
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	w.seg = &walSegment{
+		num:    num,
+		path:   path,
+		fh:     fh,
+		buf:    bufio.NewWriter(fh),
+		starts: make(map[string]int64),
+	}
+	return nil
+}
+
+// run appends the values from the queue to the log and hands them to the
+// workers until the context is done.
+func (w *wal) run(ctx context.Context, queue, logged chan queuedValue) {
+	batch := make([]queuedValue, 0, walBatch)
+	for {
+		// wait for a value, and then grab as many as we can without waiting
+		// for more.
+		select {
+		case <-ctx.Done():
+			return
+		case value := <-queue:
+			batch = append(batch[:0], value)
+		}
+	collect:
+		for len(batch) < walBatch {
+			select {
+			case value := <-queue:
+				batch = append(batch, value)
+			default:
+				break collect
+			}
+		}
+
+		// if we can't log the values, we can't promise they will be written.
+		seg, err := w.append(batch)
+		if err != nil {
+			external.Errorw("error appending to write-ahead log",
+				"err", err,
+			)
+			for _, value := range batch {
+				w.db.bufs.Put(value.data)
+				if value.done != nil {
+					value.done(false, err)
+				}
+			}
+			continue
+		}
+
+		for i := range batch {
+			batch[i].logged = &seg.pending
+		}
+		for i, value := range batch {
+			select {
+			case logged <- value:
+			case <-ctx.Done():
+				// the rest of the values are in the log, so they will be
+				// written on the next startup.
+				for _, value := range batch[i:] {
+					w.db.abandon(value)
+				}
+				return
+			}
+		}
+
+		// seal the segment if it's too large
+		if w.full() {
+			if err := w.seal(ctx); err != nil {
+				external.Errorw("error sealing write-ahead log segment",
+					"err", err,
+				)
+			}
+		}
+	}
+}
+
+// append adds the values to the current segment and syncs it to disk,
+// returning the segment. If it fails, the segment is truncated back to
+// before the values so that none of them are replayed. If even that fails,
+// the values may be replayed, so they are counted as logged and the segment
+// is sealed instead of returning an error.
+func (w *wal) append(batch []queuedValue) (seg *walSegment, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seg = w.seg
+	size := seg.size
+	starts := make(map[string]int64)
+	for _, value := range batch {
+		w.entry = appendWALEntry(w.entry[:0], walEntry{value: value})
+		if err = seg.write(w.entry); err != nil {
+			break
+		}
+		if start, ok := starts[value.metric]; !ok || value.start < start {
+			starts[value.metric] = value.start
+		}
+	}
+	if err == nil {
+		err = seg.sync()
+	}
+	if err != nil {
+		rollback_err := seg.rollback(size)
+		if rollback_err == nil {
+			return nil, err
+		}
+		external.Errorw("error rolling back write-ahead log segment",
+			"path", seg.path,
+			"err", rollback_err,
+		)
+		seg.broken = true
+	}
+
+	for metric, start := range starts {
+		if seg_start, ok := seg.starts[metric]; !ok || start < seg_start {
+			seg.starts[metric] = start
+		}
+	}
+
+	// count the values as pending only once they are going to the workers.
+	seg.pending.Add(len(batch))
+	return seg, nil
+}
+
+// tombstone appends the entry to the current segment and syncs it to disk.
+func (w *wal) tombstone(entry walEntry) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seg := w.seg
+	size := seg.size
+	w.entry = appendWALEntry(w.entry[:0], entry)
+	err = seg.write(w.entry)
+	if err == nil {
+		err = seg.sync()
+	}
+	if err != nil {
+		if rollback_err := seg.rollback(size); rollback_err != nil {
+			// the tombstone may be replayed, but so may the values logged
+			// after it. seal the segment so nothing is logged after it.
+			seg.broken = true
+		}
+		return err
+	}
+	return nil
+}
+
+// full returns true if the current segment should be sealed.
+func (w *wal) full() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.seg.broken || w.seg.size >= w.db.opts.Tuning.WALSize
+}
+
+// seal closes the current segment, hands it off to be checkpointed, and
+// starts a new segment.
+func (w *wal) seal(ctx context.Context) (err error) {
+	w.mu.Lock()
+	seg := w.seg
+	err = w.openSegment(seg.num + 1)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case w.sealed <- seg:
+	case <-ctx.Done():
+	}
+	return Error.Wrap(seg.fh.Close())
+}
+
+// close closes the current segment.
+func (w *wal) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seg.fh.Close()
+}
+
+// write adds the entry to the segment.
+func (seg *walSegment) write(entry []byte) error {
+	if _, err := seg.buf.Write(entry); err != nil {
+		return Error.Wrap(err)
+	}
+	seg.size += int64(len(entry))
+	return nil
+}
+
+// sync flushes the segment and syncs it to disk.
+func (seg *walSegment) sync() error {
+	if err := seg.buf.Flush(); err != nil {
+		return Error.Wrap(err)
+	}
+	return Error.Wrap(seg.fh.Sync())
+}
+
+// rollback discards everything written to the segment after size.
+func (seg *walSegment) rollback(size int64) error {
+	seg.buf.Reset(seg.fh)
+	seg.size = size
+	if err := seg.fh.Truncate(size); err != nil {
+		return Error.Wrap(err)
+	}
+	_, err := seg.fh.Seek(size, io.SeekStart)
+	return Error.Wrap(err)
+}
+
+// checkpoint removes sealed segments once all of their values have been
+// written and the files for them have been synced, until the context is
+// done.
+func (w *wal) checkpoint(ctx context.Context) {
+	for {
+		var seg *walSegment
+		select {
+		case <-ctx.Done():
+			return
+		case seg = <-w.sealed:
+		}
+
+		written := make(chan struct{})
+		go func() {
+			seg.pending.Wait()
+			close(written)
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-written:
+		}
+
+		// values left when shutting down are counted as written so that
+		// their buffers can be reused, but they are only in the log.
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := w.db.syncMetrics(ctx, seg.starts); err != nil {
+			// keep the segment around so that it is replayed on startup
+			external.Errorw("error syncing write-ahead log segment",
+				"path", seg.path,
+				"err", err,
+			)
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil {
+			external.Errorw("error removing write-ahead log segment",
+				"path", seg.path,
+				"err", err,
+			)
+		}
+	}
+}
+
+// walPath returns the path to the segment with the number.
+func walPath(dir string, num int) string {
+	return filepath.Join(dir, strconv.Itoa(num)+walSuffix)
+}
+
+// walSegments returns the numbers of the segments in the directory in
+// increasing order.
+func walSegments(dir string) (nums []int, err error) {
+	dh, err := os.Open(dir)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	defer dh.Close()
+
+	names, err := dh.Readdirnames(-1)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, walSuffix) {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimSuffix(name, walSuffix))
+		if err != nil {
+			continue
+		}
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	return nums, nil
+}
+
+// appendWALEntry appends the encoded entry to buf. An entry is the length
+// and crc of the payload followed by the payload. The payload is the kind and
+// the metric, followed by the start and end as varints and the data for
+// values, or the new name for renames.
+func appendWALEntry(buf []byte, entry walEntry) []byte {
+	base := len(buf)
+	var header [walHeaderSize]byte
+	buf = append(buf, header[:]...)
+
+	value := entry.value
+	var scratch [binary.MaxVarintLen64]byte
+	buf = append(buf, byte(entry.kind))
+	buf = append(buf, scratch[:binary.PutUvarint(
+		scratch[:], uint64(len(value.metric)))]...)
+	buf = append(buf, value.metric...)
+	switch entry.kind {
+	case walKind_value:
+		buf = append(buf, scratch[:binary.PutVarint(
+			scratch[:], value.start)]...)
+		buf = append(buf, scratch[:binary.PutVarint(
+			scratch[:], value.end)]...)
+		buf = append(buf, value.data...)
+	case walKind_rename:
+		buf = append(buf, entry.to...)
+	}
+
+	payload := buf[base+walHeaderSize:]
+	binary.LittleEndian.PutUint32(buf[base:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[base+4:],
+		crc32.Checksum(payload, castTable))
+	return buf
+}
+
+// parseWALEntry parses the entry at the start of data, returning it, the
+// data after it, and if it was valid. The value in the entry references data.
+func parseWALEntry(data []byte) (entry walEntry, rem []byte, ok bool) {
+	if len(data) < walHeaderSize {
+		return entry, nil, false
+	}
+	size := binary.LittleEndian.Uint32(data[0:4])
+	crc := binary.LittleEndian.Uint32(data[4:8])
+	data = data[walHeaderSize:]
+	if uint64(size) > uint64(len(data)) {
+		return entry, nil, false
+	}
+	payload, rem := data[:size], data[size:]
+	if crc32.Checksum(payload, castTable) != crc {
+		return entry, nil, false
+	}
+
+	if len(payload) < 1 {
+		return entry, nil, false
+	}
+	entry.kind = walKind(payload[0])
+	payload = payload[1:]
+
+	metric_len, n := binary.Uvarint(payload)
+	if n <= 0 || metric_len > uint64(len(payload)-n) {
+		return entry, nil, false
+	}
+	payload = payload[n:]
+	entry.value.metric = string(payload[:metric_len])
+	payload = payload[metric_len:]
+
+	switch entry.kind {
+	case walKind_value:
+		if entry.value.start, n = binary.Varint(payload); n <= 0 {
+			return entry, nil, false
+		}
+		payload = payload[n:]
+		if entry.value.end, n = binary.Varint(payload); n <= 0 {
+			return entry, nil, false
+		}
+		entry.value.data = payload[n:]
+
+	case walKind_delete:
+		if len(payload) > 0 {
+			return entry, nil, false
+		}
+
+	case walKind_rename:
+		entry.to = string(payload)
+
+	default:
+		return entry, nil, false
+	}
+
+	return entry, rem, true
+}
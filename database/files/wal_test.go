@@ -0,0 +1,278 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package files
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+)
+
+func TestWAL(t *testing.T) {
+	t.Run("Entry", func(t *testing.T) {
+		entries := []walEntry{
+			{value: queuedValue{
+				metric: "foo.bar",
+				start:  -10,
+				end:    20,
+				data:   []byte("some data"),
+			}},
+			{kind: walKind_delete, value: queuedValue{metric: "foo.bar"}},
+			{kind: walKind_rename, value: queuedValue{metric: "foo"},
+				to: "bar"},
+		}
+
+		buf := []byte("prefix")
+		for _, entry := range entries {
+			buf = appendWALEntry(buf, entry)
+		}
+		buf = buf[len("prefix"):]
+
+		for _, entry := range entries {
+			got, rem, ok := parseWALEntry(buf)
+			assert.That(t, ok)
+			assert.Equal(t, got.kind, entry.kind)
+			assert.Equal(t, got.value.metric, entry.value.metric)
+			assert.Equal(t, got.value.start, entry.value.start)
+			assert.Equal(t, got.value.end, entry.value.end)
+			assert.Equal(t, string(got.value.data), string(entry.value.data))
+			assert.Equal(t, got.to, entry.to)
+			buf = rem
+		}
+		assert.Equal(t, len(buf), 0)
+	})
+
+	t.Run("Torn", func(t *testing.T) {
+		buf := appendWALEntry(nil, walEntry{
+			value: queuedValue{metric: "foo", end: 1},
+		})
+		for i := 0; i < len(buf); i++ {
+			_, _, ok := parseWALEntry(buf[:i])
+			assert.That(t, !ok)
+		}
+
+		buf[len(buf)-1]++
+		_, _, ok := parseWALEntry(buf)
+		assert.That(t, !ok)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{WAL: true})
+		defer cleanup()
+
+		w := &wal{db: db, dir: db.dir}
+		assert.NoError(t, w.openSegment(1))
+		defer w.close()
+
+		_, err := w.append([]queuedValue{{metric: "foo", end: 1}})
+		assert.NoError(t, err)
+		size := w.seg.size
+
+		assert.NoError(t, w.seg.write([]byte("partial")))
+		assert.NoError(t, w.seg.sync())
+		assert.NoError(t, w.seg.rollback(size))
+
+		_, err = w.append([]queuedValue{{metric: "foo", end: 2}})
+		assert.NoError(t, err)
+
+		data, err := ioutil.ReadFile(w.seg.path)
+		assert.NoError(t, err)
+		for end := int64(1); end <= 2; end++ {
+			entry, rem, ok := parseWALEntry(data)
+			assert.That(t, ok)
+			assert.Equal(t, entry.value.end, end)
+			data = rem
+		}
+		assert.Equal(t, len(data), 0)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:  1024,
+			Cap:   10,
+			Files: 10,
+			WAL:   true,
+		})
+		defer cleanup()
+
+		// write a segment as if we crashed before any of the values were
+		// written, with a torn entry at the end.
+		dir := filepath.Join(db.dir, walDir)
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		var buf []byte
+		for i := int64(0); i < 10; i++ {
+			buf = appendWALEntry(buf, walEntry{value: queuedValue{
+				metric: "metric",
+				start:  i,
+				end:    i + 1,
+				data:   testRecordData(t, i, i+1, float64(i)),
+			}})
+		}
+		buf = appendWALEntry(buf, walEntry{
+			value: queuedValue{metric: "torn", end: 1},
+		})
+		buf = buf[:len(buf)-1]
+		assert.NoError(t, ioutil.WriteFile(walPath(dir, 5), buf, 0644))
+
+		// also write the first few values into the files already
+		for i := int64(0); i < 3; i++ {
+			testWriteRecord(t, db, "metric", i, i+1, float64(i))
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go db.Run(ctx)
+
+		// queueing a value waits for the replay because the log must be
+		// opened first.
+		testQueueValue(t, db, "other", 0, 1)
+
+		assert.Equal(t, len(testQueryRecords(t, db, ctx, "metric")), 10)
+		assert.Equal(t, len(testMetricNames(t, db)), 2)
+
+		// the replayed segment is gone and a new one is started after it
+		nums, err := walSegments(dir)
+		assert.NoError(t, err)
+		assert.DeepEqual(t, nums, []int{6})
+	})
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		db, cleanup := newTestDB(t, Options{
+			Size:   1024,
+			Cap:    10,
+			Files:  10,
+			WAL:    true,
+			Tuning: Tuning{WALSize: 1},
+		})
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go db.Run(ctx)
+
+		for i := int64(0); i < 10; i++ {
+			testQueueValue(t, db, "metric", i, i+1)
+		}
+
+		// every batch seals a segment, and they are removed once written
+		dir := filepath.Join(db.dir, walDir)
+		for {
+			nums, err := walSegments(dir)
+			assert.NoError(t, err)
+			if len(nums) == 1 {
+				assert.That(t, nums[0] > 1)
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	t.Run("Tombstone", func(t *testing.T) {
+		// run starts the database, writes the values, runs the function
+		// and stops the database before the segment is checkpointed.
+		run := func(t *testing.T, db *DB, fn func()) {
+			ctx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				db.Run(ctx)
+				close(done)
+			}()
+			fn()
+			cancel()
+			<-done
+		}
+
+		newDB := func(t *testing.T) (*DB, func()) {
+			return newTestDB(t, Options{
+				Size:  1024,
+				Cap:   10,
+				Files: 10,
+				WAL:   true,
+			})
+		}
+
+		t.Run("Delete", func(t *testing.T) {
+			db, cleanup := newDB(t)
+			defer cleanup()
+
+			run(t, db, func() {
+				for i := int64(1); i <= 5; i++ {
+					testQueueValue(t, db, "deleted", i, i+1)
+					testQueueValue(t, db, "kept", i, i+1)
+				}
+				assert.NoError(t, db.Delete(ctx, "deleted"))
+				testQueueValue(t, db, "recreated", 1, 2)
+				assert.NoError(t, db.Delete(ctx, "recreated"))
+				testQueueValue(t, db, "recreated", 2, 3)
+			})
+
+			// replaying the log must not bring the metric back, but values
+			// logged after the delete are kept.
+			run(t, db, func() {
+				testQueueValue(t, db, "other", 1, 2)
+			})
+			assert.DeepEqual(t, testMetricNames(t, db),
+				[]string{"kept", "other", "recreated"})
+			assert.Equal(t, len(testQueryRecords(t, db, ctx, "kept")), 5)
+			assert.Equal(t,
+				len(testQueryRecords(t, db, ctx, "recreated")), 1)
+		})
+
+		t.Run("Rename", func(t *testing.T) {
+			db, cleanup := newDB(t)
+			defer cleanup()
+
+			run(t, db, func() {
+				for i := int64(1); i <= 5; i++ {
+					testQueueValue(t, db, "from", i, i+1)
+				}
+				assert.NoError(t, db.Rename(ctx, "from", "to"))
+			})
+
+			run(t, db, func() {
+				testQueueValue(t, db, "other", 1, 2)
+			})
+			assert.DeepEqual(t, testMetricNames(t, db),
+				[]string{"other", "to"})
+			assert.Equal(t, len(testQueryRecords(t, db, ctx, "to")), 5)
+		})
+
+		t.Run("Offline", func(t *testing.T) {
+			db, cleanup := newDB(t)
+			defer cleanup()
+
+			run(t, db, func() {
+				testQueueValue(t, db, "deleted", 1, 2)
+			})
+
+			// deleting while the database isn't running logs the tombstone
+			// after the segment that is left.
+			assert.NoError(t, db.Delete(ctx, "deleted"))
+			run(t, db, func() {
+				testQueueValue(t, db, "other", 1, 2)
+			})
+			assert.DeepEqual(t, testMetricNames(t, db), []string{"other"})
+		})
+	})
+}
+
+// testQueueValue queues a value for the metric and waits for it to be
+// written.
+func testQueueValue(t testing.TB, db *DB, metric string, start, end int64) {
+	type res struct {
+		ok  bool
+		err error
+	}
+	ch := make(chan res, 1)
+	assert.NoError(t, db.Queue(ctx, metric, start, end,
+		testRecordData(t, start, end, float64(start)),
+		func(ok bool, err error) { ch <- res{ok, err} }))
+
+	r := <-ch
+	assert.NoError(t, r.err)
+	assert.That(t, r.ok)
+}
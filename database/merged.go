@@ -0,0 +1,152 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// MergedCallback is a function used to pass results back from MergedQuery.
+// It is like a ResultCallback, but is also passed the metric the data is for.
+type MergedCallback func(ctx context.Context, metric string, start, end int64,
+	data []byte) (bool, error)
+
+// MergedQuery calls the MergedCallback with all of the data slices for all of
+// the metrics that end strictly before the provided end time, in decreasing
+// order by their end. Data that end at the same time are passed in the order
+// of the metrics. Like Query, it continues until it exhausts all of the
+// records, or the callback returns false.
+func MergedQuery(ctx context.Context, source Source, metrics []string,
+	end int64, cb MergedCallback) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	// start a query for every metric. each one blocks in its callback until
+	// the data it passed has been consumed, so that the data stays valid
+	// without copying it.
+	streams := make([]*mergedStream, len(metrics))
+	for i, metric := range metrics {
+		streams[i] = &mergedStream{
+			index:  i,
+			metric: metric,
+			items:  make(chan mergedItem),
+			next:   make(chan struct{}),
+		}
+
+		wg.Add(1)
+		go func(s *mergedStream) {
+			defer wg.Done()
+			s.err = source.Query(ctx, s.metric, end, nil, s.callback)
+			close(s.items)
+		}(streams[i])
+	}
+
+	// wait for the first data from every stream
+	var queue mergedQueue
+	for _, s := range streams {
+		ok, err := s.receive()
+		if err != nil {
+			return err
+		}
+		if ok {
+			queue = append(queue, s)
+		}
+	}
+	heap.Init(&queue)
+
+	// pass along the latest data until we're done
+	for len(queue) > 0 {
+		s := queue[0]
+		cont, err := cb(ctx, s.metric, s.item.start, s.item.end, s.item.data)
+		if err != nil || !cont {
+			return err
+		}
+
+		s.next <- struct{}{}
+		ok, err := s.receive()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&queue, 0)
+		} else {
+			heap.Pop(&queue)
+		}
+	}
+
+	return nil
+}
+
+// mergedItem is some data passed to a Query callback.
+type mergedItem struct {
+	start, end int64
+	data       []byte
+}
+
+// mergedStream is the state of a Query for one metric.
+type mergedStream struct {
+	index  int
+	metric string
+	items  chan mergedItem
+	next   chan struct{}
+	item   mergedItem
+	err    error
+}
+
+// callback is the ResultCallback passed to Query. It hands the data to the
+// merging goroutine and waits until it is done with it.
+func (s *mergedStream) callback(ctx context.Context, start, end int64,
+	data []byte) (bool, error) {
+
+	select {
+	case s.items <- mergedItem{start: start, end: end, data: data}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	select {
+	case <-s.next:
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// receive waits for the next data from the stream. It returns false if the
+// stream has no more data.
+func (s *mergedStream) receive() (bool, error) {
+	item, ok := <-s.items
+	if !ok {
+		return false, s.err
+	}
+	s.item = item
+	return true, nil
+}
+
+// mergedQueue is a heap of streams ordered by the end of their data, latest
+// first.
+type mergedQueue []*mergedStream
+
+func (q mergedQueue) Len() int { return len(q) }
+
+func (q mergedQueue) Less(i, j int) bool {
+	if q[i].item.end != q[j].item.end {
+		return q[i].item.end > q[j].item.end
+	}
+	return q[i].index < q[j].index
+}
+
+func (q mergedQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *mergedQueue) Push(x interface{}) { *q = append(*q, x.(*mergedStream)) }
+
+func (q *mergedQueue) Pop() interface{} {
+	s := (*q)[len(*q)-1]
+	*q = (*q)[:len(*q)-1]
+	return s
+}
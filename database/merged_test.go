@@ -0,0 +1,140 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+var ctx = context.Background()
+
+// testSource is a Source where every metric has records ending at the listed
+// times, each with a duration of 1.
+type testSource struct {
+	ends map[string][]int64
+	err  error
+}
+
+func (t testSource) Query(ctx context.Context, metric string, end int64,
+	buf []byte, cb ResultCallback) error {
+
+	ends := t.ends[metric]
+	for i := len(ends) - 1; i >= 0; i-- {
+		if ends[i] >= end {
+			continue
+		}
+		data := []byte(fmt.Sprintf("%s@%d", metric, ends[i]))
+		if ok, err := cb(ctx, ends[i]-1, ends[i], data); !ok || err != nil {
+			return err
+		}
+	}
+	return t.err
+}
+
+func (t testSource) QueryLatest(ctx context.Context, metric string,
+	buf []byte) (start, end int64, data []byte, err error) {
+
+	return 0, 0, nil, errors.New("unimplemented")
+}
+
+func (t testSource) Metrics(ctx context.Context,
+	cb func(name string) (bool, error)) error {
+
+	return errors.New("unimplemented")
+}
+
+func TestMergedQuery(t *testing.T) {
+	source := testSource{ends: map[string][]int64{
+		"a": {1, 4, 5, 9},
+		"b": {2, 4, 6},
+		"c": {},
+		"d": {3, 10, 11},
+	}}
+	metrics := []string{"a", "b", "c", "d"}
+
+	collect := func(end int64, limit int) (got []string) {
+		err := MergedQuery(ctx, source, metrics, end,
+			func(ctx context.Context, metric string, start, end int64,
+				data []byte) (bool, error) {
+
+				got = append(got, string(data))
+				assert.Equal(t, got[len(got)-1],
+					fmt.Sprintf("%s@%d", metric, end))
+				return len(got) < limit, nil
+			})
+		assert.NoError(t, err)
+		return got
+	}
+
+	t.Run("All", func(t *testing.T) {
+		assert.DeepEqual(t, collect(100, 100), []string{
+			"d@11", "d@10", "a@9", "b@6", "a@5", "a@4", "b@4", "d@3",
+			"b@2", "a@1",
+		})
+	})
+
+	t.Run("End", func(t *testing.T) {
+		assert.DeepEqual(t, collect(6, 100), []string{
+			"a@5", "a@4", "b@4", "d@3", "b@2", "a@1",
+		})
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		assert.DeepEqual(t, collect(100, 3), []string{"d@11", "d@10", "a@9"})
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		source := testSource{ends: source.ends, err: errors.New("boom")}
+		err := MergedQuery(ctx, source, metrics, 100,
+			func(ctx context.Context, metric string, start, end int64,
+				data []byte) (bool, error) {
+
+				return true, nil
+			})
+		assert.Error(t, err)
+	})
+}
+
+type testRangeSource struct {
+	testSource
+	called *bool
+}
+
+func (t testRangeSource) QueryRange(ctx context.Context, metric string,
+	start, end int64, buf []byte, cb ResultCallback) error {
+
+	*t.called = true
+	return QueryRange(ctx, t.testSource, metric, start, end, buf, cb)
+}
+
+func TestQueryRange(t *testing.T) {
+	source := testSource{ends: map[string][]int64{"a": {1, 2, 3, 4, 5}}}
+
+	query := func(t *testing.T, source Source) {
+		var got []int64
+		err := QueryRange(ctx, source, "a", 2, 5, nil,
+			func(ctx context.Context, start, end int64, data []byte) (
+				bool, error) {
+
+				got = append(got, end)
+				return true, nil
+			})
+		assert.NoError(t, err)
+		assert.DeepEqual(t, got, []int64{4, 3})
+	}
+
+	t.Run("Query", func(t *testing.T) {
+		query(t, source)
+	})
+
+	t.Run("RangeSource", func(t *testing.T) {
+		called := false
+		query(t, testRangeSource{testSource: source, called: &called})
+		assert.That(t, called)
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"context"
+)
+
+// RangeSource is a Source that can find the data slices in a time range more
+// efficiently than by stopping a Query.
+type RangeSource interface {
+	Source
+
+	// QueryRange is like Query, but only calls the ResultCallback with the
+	// data slices that also end strictly after the provided start time.
+	QueryRange(ctx context.Context, metric string, start, end int64,
+		buf []byte, cb ResultCallback) error
+}
+
+// QueryRange calls QueryRange on the source if it is a RangeSource, and
+// otherwise calls Query, stopping at the first data slice that ends at or
+// before the start time.
+func QueryRange(ctx context.Context, source Source, metric string,
+	start, end int64, buf []byte, cb ResultCallback) error {
+
+	if ranged, ok := source.(RangeSource); ok {
+		return ranged.QueryRange(ctx, metric, start, end, buf, cb)
+	}
+
+	return source.Query(ctx, metric, end, buf,
+		func(ctx context.Context, rec_start, rec_end int64, data []byte) (
+			bool, error) {
+
+			if rec_end <= start {
+				return false, nil
+			}
+			return cb(ctx, rec_start, rec_end, data)
+		})
+}
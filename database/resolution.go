@@ -0,0 +1,28 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// resolutionKey is the context key for the resolution of a query.
+type resolutionKey struct{}
+
+// WithResolution returns a context that tells a Source the caller does not
+// need data any finer than the resolution. A Source that stores coarser
+// records for long periods may return them in place of the finer records
+// they were merged from.
+func WithResolution(ctx context.Context,
+	resolution time.Duration) context.Context {
+
+	return context.WithValue(ctx, resolutionKey{}, resolution)
+}
+
+// Resolution returns the resolution associated with the context, or zero if
+// the caller needs the finest data available.
+func Resolution(ctx context.Context) time.Duration {
+	resolution, _ := ctx.Value(resolutionKey{}).(time.Duration)
+	return resolution
+}
@@ -52,3 +52,15 @@ type DB interface {
 	// context will be canceled when it is expected to shut down.
 	Run(ctx context.Context) error
 }
+
+// Manager is a DB that can also remove and rename metrics.
+type Manager interface {
+	DB
+
+	// Delete removes all of the data stored for the metric.
+	Delete(ctx context.Context, metric string) error
+
+	// Rename moves all of the data stored for the metric named from to the
+	// metric named to. It is an error if the metric named to has data.
+	Rename(ctx context.Context, from, to string) error
+}
@@ -38,3 +38,27 @@ type Params interface {
 	// Unmarshal should load the Dist from the provided data slice.
 	Unmarshal(data []byte) (Dist, error)
 }
+
+// Merger is an optional interface a Dist can implement to combine another
+// Dist of the same kind into itself without any loss from resampling.
+type Merger interface {
+	// Merge adds all of the observations in other into the Dist. It should
+	// return an error if other is not of the same kind.
+	Merge(other Dist) error
+}
+
+// WeightedObserver is an optional interface a Dist can implement to observe
+// a value many times without calling Observe repeatedly.
+type WeightedObserver interface {
+	// ObserveWeighted observes the value as if Observe was called weight
+	// times.
+	ObserveWeighted(val float64, weight int64)
+}
+
+// ExactCDFer is an optional interface a Dist can implement if its CDF method
+// is an estimate, but it is able to compute a more exact CDF at some cost.
+type ExactCDFer interface {
+	// ExactCDF returns the percentile for the given value. The percentile is
+	// represented as a number in [0, 1].
+	ExactCDF(x float64) float64
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package dist
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/zeebo/errs"
+)
+
+// Error wraps all of the errors originating at this package.
+var Error = errs.Class("dist")
+
+// headerMagic is the first byte of every marshaled distribution that has a
+// Header. Encodings written before headers existed never begin with it.
+const headerMagic = 0xd1
+
+// Header describes the encoding of a marshaled distribution. Kinds write it
+// in front of their encoding so that the data is self-describing and can
+// evolve over time.
+type Header struct {
+	// Kind is the kind of the distribution.
+	Kind string
+
+	// Version is the version of the kind specific encoding that follows.
+	Version uint8
+
+	// Params are kind specific parameters the distribution was created with,
+	// for example the compression of a t-digest.
+	Params []float64
+}
+
+// AppendHeader appends the encoded form of the header to buf.
+func AppendHeader(buf []byte, h Header) []byte {
+	var scratch [8]byte
+
+	buf = append(buf, headerMagic, uint8(len(h.Kind)))
+	buf = append(buf, h.Kind...)
+	buf = append(buf, h.Version, uint8(len(h.Params)))
+	for _, param := range h.Params {
+		binary.BigEndian.PutUint64(scratch[:], math.Float64bits(param))
+		buf = append(buf, scratch[:]...)
+	}
+	return buf
+}
+
+// ParseHeader reads a Header from the front of the data, returning the rest
+// of the data as the body. If the data does not start with a header, ok is
+// false and the data was written before headers existed.
+func ParseHeader(data []byte) (h Header, body []byte, ok bool, err error) {
+	if len(data) == 0 || data[0] != headerMagic {
+		return h, data, false, nil
+	}
+	data = data[1:]
+
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return h, nil, true, Error.New("truncated header kind")
+	}
+	h.Kind, data = string(data[1:1+int(data[0])]), data[1+int(data[0]):]
+
+	if len(data) < 2 {
+		return h, nil, true, Error.New("truncated header version")
+	}
+	h.Version, data = data[0], data[1:]
+
+	params := int(data[0])
+	data = data[1:]
+	if len(data) < 8*params {
+		return h, nil, true, Error.New("truncated header params")
+	}
+	for i := 0; i < params; i++ {
+		bits := binary.BigEndian.Uint64(data[8*i:])
+		h.Params = append(h.Params, math.Float64frombits(bits))
+	}
+
+	return h, data[8*params:], true, nil
+}
+
+// Check returns an error if the header is not for the kind, or is for a
+// version newer than the provided version.
+func (h Header) Check(kind string, version uint8) error {
+	if h.Kind != kind {
+		return Error.New("incompatible kind: data is %q but expected %q",
+			h.Kind, kind)
+	}
+	if h.Version > version {
+		return Error.New("incompatible %s version: data is version %d but "+
+			"only up to version %d is supported", kind, h.Version, version)
+	}
+	return nil
+}
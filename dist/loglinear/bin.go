@@ -0,0 +1,114 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package loglinear
+
+import "math"
+
+const (
+	// minExp and maxExp bound the exponent of a bin.
+	minExp = math.MinInt8
+	maxExp = math.MaxInt8
+
+	// valsPerExp is how many bins there are for each sign and exponent.
+	valsPerExp = 90
+)
+
+// bin is a log-linear histogram bin. If val is zero, it is the bin holding
+// exactly zero. Otherwise, val is in [10, 99] or [-99, -10] and the bin
+// covers the values from val * 10^(exp-1) up to the next val away from zero.
+// For example, the bin {12, 3} covers [1200, 1300) and {-12, 3} covers
+// (-1300, -1200].
+type bin struct {
+	val int8
+	exp int8
+}
+
+// binOf returns the bin containing the finite value v. Values too close to
+// zero for any bin are placed in the zero bin, and values too far from zero
+// are placed in the outermost bins.
+func binOf(v float64) bin {
+	a := math.Abs(v)
+	if a < math.Pow10(minExp) {
+		return bin{}
+	}
+
+	exp := int(math.Floor(math.Log10(a)))
+	val := int(a / math.Pow10(exp-1))
+
+	if val > 99 {
+		val, exp = 10, exp+1
+	} else if val < 10 {
+		val, exp = 99, exp-1
+	}
+
+	// the logarithm and division may be off by a little, so nudge the bin
+	// until its edges agree with the value.
+	for a < binLower(val, exp) {
+		if val--; val < 10 {
+			val, exp = 99, exp-1
+		}
+	}
+	for a >= binLower(val+1, exp) {
+		if val++; val > 99 {
+			val, exp = 10, exp+1
+		}
+	}
+
+	switch {
+	case exp < minExp:
+		val, exp = 10, minExp
+	case exp > maxExp:
+		val, exp = 99, maxExp
+	}
+	if v < 0 {
+		val = -val
+	}
+	return bin{val: int8(val), exp: int8(exp)}
+}
+
+// binLower returns the lower edge of the positive bin with the given val and
+// exp. A val of 100 is the lower edge of the next exponent.
+func binLower(val, exp int) float64 {
+	if val == 100 {
+		val, exp = 10, exp+1
+	}
+	// dividing by an exact power of ten keeps small edges correctly rounded
+	// where multiplying by a negative power would not.
+	if exp < 1 {
+		return float64(val) / math.Pow10(1-exp)
+	}
+	return float64(val) * math.Pow10(exp-1)
+}
+
+// valid returns if the bin is a possible bin.
+func (b bin) valid() bool {
+	if b.val == 0 {
+		return b.exp == 0
+	}
+	return (b.val >= 10 && b.val <= 99) || (b.val >= -99 && b.val <= -10)
+}
+
+// key returns an integer that orders bins by the values they contain.
+func (b bin) key() int {
+	if b.val == 0 {
+		return 0
+	}
+	val := int(b.val)
+	if val < 0 {
+		return -((int(b.exp)-minExp)*valsPerExp + (-val - 10) + 1)
+	}
+	return (int(b.exp)-minExp)*valsPerExp + (val - 10) + 1
+}
+
+// edges returns the smallest and largest values in the bin.
+func (b bin) edges() (lo, hi float64) {
+	val, exp := int(b.val), int(b.exp)
+	switch {
+	case val > 0:
+		return binLower(val, exp), binLower(val+1, exp)
+	case val < 0:
+		return -binLower(-val+1, exp), -binLower(-val, exp)
+	default:
+		return 0, 0
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (C) 2018. See AUTHORS.
+
+// package loglinear provides a log-linear histogram distribution.
+//
+// Values are counted in base 10 bins with two significant digits, in the
+// style of circllhist. For example, 1234 falls in the bin [1200, 1300) and
+// 0.0567 falls in the bin [0.056, 0.057). Every bin is at most 10% as wide as
+// its lower edge, so the relative error of any quantile is bounded by that
+// regardless of the range of the values. Only bins with values are stored,
+// and histograms merge exactly by adding counts.
+package loglinear
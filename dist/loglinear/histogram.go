@@ -0,0 +1,286 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package loglinear
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/zeebo/rothko/dist"
+)
+
+// encodingVersion is the version of the encoding written by Marshal.
+const encodingVersion = 1
+
+// Params implements dist.Params for a log-linear histogram. It has no
+// parameters because the bins are fixed.
+type Params struct{}
+
+// Kind returns the loglinear distribution kind.
+func (p Params) Kind() string {
+	return "loglinear"
+}
+
+// New returns a new Histogram as a dist.Dist.
+func (p Params) New() (dist.Dist, error) {
+	return new(Histogram), nil
+}
+
+// Unmarshal loads a dist.Dist out of some bytes.
+func (p Params) Unmarshal(data []byte) (dist.Dist, error) {
+	hdr, body, ok, err := dist.ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, dist.Error.New("loglinear encoding missing header")
+	}
+	if err := hdr.Check("loglinear", encodingVersion); err != nil {
+		return nil, err
+	}
+
+	n, body, err := readUvarint(body)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(body)/3) {
+		return nil, dist.Error.New("loglinear encoding truncated")
+	}
+
+	h := &Histogram{
+		bins:   make([]bin, 0, n),
+		counts: make([]int64, 0, n),
+	}
+	for i := uint64(0); i < n; i++ {
+		if len(body) < 2 {
+			return nil, dist.Error.New("loglinear encoding truncated")
+		}
+		b := bin{val: int8(body[0]), exp: int8(body[1])}
+		if !b.valid() {
+			return nil, dist.Error.New("loglinear encoding has invalid bin")
+		}
+		if len(h.bins) > 0 && h.bins[len(h.bins)-1].key() >= b.key() {
+			return nil, dist.Error.New("loglinear encoding has unsorted bins")
+		}
+
+		var count uint64
+		count, body, err = readUvarint(body[2:])
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 || count > math.MaxInt64-uint64(h.count) {
+			return nil, dist.Error.New("loglinear encoding has invalid count")
+		}
+
+		h.bins = append(h.bins, b)
+		h.counts = append(h.counts, int64(count))
+		h.count += int64(count)
+	}
+	if len(body) != 0 {
+		return nil, dist.Error.New("loglinear encoding has trailing data")
+	}
+
+	return h, nil
+}
+
+// readUvarint reads a uvarint from the front of the data.
+func readUvarint(data []byte) (uint64, []byte, error) {
+	val, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, dist.Error.New("loglinear encoding truncated")
+	}
+	return val, data[n:], nil
+}
+
+//
+// Histogram
+//
+
+// Histogram implements dist.Dist for a log-linear histogram. The zero value
+// is an empty histogram.
+type Histogram struct {
+	bins   []bin   // sorted by key
+	counts []int64 // counts[i] is the count in bins[i]
+	count  int64
+	table  dist.Table
+}
+
+var (
+	// type assert the interfaces we expect to implement
+	_ dist.Dist             = (*Histogram)(nil)
+	_ dist.Merger           = (*Histogram)(nil)
+	_ dist.WeightedObserver = (*Histogram)(nil)
+	_ dist.ExactCDFer       = (*Histogram)(nil)
+	_ dist.Tabler           = (*Histogram)(nil)
+)
+
+// Kind returns the string "loglinear".
+func (h *Histogram) Kind() string {
+	return "loglinear"
+}
+
+// Len returns how many observations there were.
+func (h *Histogram) Len() int64 {
+	return h.count
+}
+
+// Bins returns how many bins have values in them.
+func (h *Histogram) Bins() int {
+	return len(h.bins)
+}
+
+// Observe adds the value to the histogram.
+func (h *Histogram) Observe(val float64) {
+	h.ObserveWeighted(val, 1)
+}
+
+// ObserveWeighted adds the value to the histogram weight times.
+func (h *Histogram) ObserveWeighted(val float64, weight int64) {
+	if weight <= 0 || math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+
+	b := binOf(val)
+	key := b.key()
+	i := sort.Search(len(h.bins), func(i int) bool {
+		return h.bins[i].key() >= key
+	})
+	if i == len(h.bins) || h.bins[i] != b {
+		h.bins = append(h.bins, bin{})
+		h.counts = append(h.counts, 0)
+		copy(h.bins[i+1:], h.bins[i:])
+		copy(h.counts[i+1:], h.counts[i:])
+		h.bins[i], h.counts[i] = b, 0
+	}
+
+	h.counts[i] += weight
+	h.count += weight
+	h.table = dist.Table{}
+}
+
+// Merge adds the counts of every bin in the other histogram.
+func (h *Histogram) Merge(other dist.Dist) error {
+	oh, ok := other.(*Histogram)
+	if !ok {
+		return dist.Error.New("cannot merge %q into loglinear", other.Kind())
+	}
+	if oh.count == 0 {
+		return nil
+	}
+
+	bins := make([]bin, 0, len(h.bins)+len(oh.bins))
+	counts := make([]int64, 0, len(h.bins)+len(oh.bins))
+
+	i, j := 0, 0
+	for i < len(h.bins) || j < len(oh.bins) {
+		switch {
+		case j == len(oh.bins) ||
+			(i < len(h.bins) && h.bins[i].key() < oh.bins[j].key()):
+			bins, counts = append(bins, h.bins[i]), append(counts, h.counts[i])
+			i++
+		case i == len(h.bins) || oh.bins[j].key() < h.bins[i].key():
+			bins, counts = append(bins, oh.bins[j]), append(counts, oh.counts[j])
+			j++
+		default:
+			bins = append(bins, h.bins[i])
+			counts = append(counts, h.counts[i]+oh.counts[j])
+			i, j = i+1, j+1
+		}
+	}
+
+	h.bins, h.counts = bins, counts
+	h.count += oh.count
+	h.table = dist.Table{}
+	return nil
+}
+
+// Marshal appends a byte form of the histogram to the provided buffer. After
+// the dist.Header, it is the number of bins followed by each bin's val and
+// exp bytes and count, with the numbers as uvarints.
+func (h *Histogram) Marshal(buf []byte) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+
+	buf = dist.AppendHeader(buf, dist.Header{
+		Kind:    "loglinear",
+		Version: encodingVersion,
+	})
+
+	n := binary.PutUvarint(scratch[:], uint64(len(h.bins)))
+	buf = append(buf, scratch[:n]...)
+	for i, b := range h.bins {
+		buf = append(buf, uint8(b.val), uint8(b.exp))
+		n := binary.PutUvarint(scratch[:], uint64(h.counts[i]))
+		buf = append(buf, scratch[:n]...)
+	}
+
+	return buf
+}
+
+// Query returns the x'th quantile, interpolating linearly inside of the bin
+// that contains it. The relative error is at most 10%.
+func (h *Histogram) Query(x float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	if x <= 0 {
+		lo, _ := h.bins[0].edges()
+		return lo
+	}
+	if x >= 1 {
+		_, hi := h.bins[len(h.bins)-1].edges()
+		return hi
+	}
+
+	target := x * float64(h.count)
+	cum := 0.0
+	for i, b := range h.bins {
+		count := float64(h.counts[i])
+		if cum+count >= target {
+			lo, hi := b.edges()
+			return lo + (target-cum)/count*(hi-lo)
+		}
+		cum += count
+	}
+
+	_, hi := h.bins[len(h.bins)-1].edges()
+	return hi
+}
+
+// CDF returns the percentile of the value x, assuming that values are spread
+// evenly inside of each bin.
+func (h *Histogram) CDF(x float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	cum := 0.0
+	for i, b := range h.bins {
+		lo, hi := b.edges()
+		if x < lo {
+			break
+		}
+		if x >= hi {
+			cum += float64(h.counts[i])
+			continue
+		}
+		cum += float64(h.counts[i]) * (x - lo) / (hi - lo)
+		break
+	}
+
+	return cum / float64(h.count)
+}
+
+// ExactCDF is the same as CDF because the histogram is cheap to evaluate.
+func (h *Histogram) ExactCDF(x float64) float64 {
+	return h.CDF(x)
+}
+
+// Table returns a table of quantiles for the histogram. It is computed once
+// and cached until more values are observed.
+func (h *Histogram) Table() dist.Table {
+	if h.table.Size() == 0 {
+		h.table = dist.NewTable(h, dist.DefaultTableSize)
+	}
+	return h.table
+}
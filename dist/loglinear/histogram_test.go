@@ -0,0 +1,145 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package loglinear
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestBin(t *testing.T) {
+	t.Run("Edges", func(t *testing.T) {
+		for _, test := range []struct {
+			val    float64
+			lo, hi float64
+		}{
+			{1234, 1200, 1300},
+			{0.0567, 0.056, 0.057},
+			{1, 1, 1.1},
+			{9.99, 9.9, 10},
+			{10, 10, 11},
+			{-1234, -1300, -1200},
+			{0, 0, 0},
+		} {
+			lo, hi := binOf(test.val).edges()
+			assert.That(t, math.Abs(lo-test.lo) <= 1e-12*math.Abs(test.lo))
+			assert.That(t, math.Abs(hi-test.hi) <= 1e-12*math.Abs(test.hi))
+		}
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 100000; i++ {
+			val := math.Exp(rng.NormFloat64() * 50)
+			b := binOf(val)
+			assert.That(t, b.valid())
+			lo, hi := b.edges()
+			assert.That(t, lo <= val && val < hi)
+		}
+	})
+
+	t.Run("Powers", func(t *testing.T) {
+		for exp := -22; exp <= 22; exp++ {
+			b := binOf(math.Pow10(exp))
+			assert.Equal(t, b, bin{val: 10, exp: int8(exp)})
+		}
+	})
+
+	t.Run("Extremes", func(t *testing.T) {
+		assert.Equal(t, binOf(1e-200), bin{})
+		assert.Equal(t, binOf(math.MaxFloat64), bin{val: 99, exp: maxExp})
+		assert.Equal(t, binOf(-math.MaxFloat64), bin{val: -99, exp: maxExp})
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		vals := []float64{-1e10, -12, -11, -1, 0, 1e-50, 1, 9.9, 10, 1e10}
+		for i := 1; i < len(vals); i++ {
+			assert.That(t, binOf(vals[i-1]).key() < binOf(vals[i]).key())
+		}
+	})
+}
+
+func newTestHistogram(t testing.TB, vals []float64) *Histogram {
+	d, err := Params{}.New()
+	assert.NoError(t, err)
+	for _, val := range vals {
+		d.Observe(val)
+	}
+	return d.(*Histogram)
+}
+
+func TestHistogram(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	t.Run("Error", func(t *testing.T) {
+		vals := make([]float64, 10000)
+		for i := range vals {
+			vals[i] = math.Exp(rng.NormFloat64() * 10)
+		}
+		h := newTestHistogram(t, vals)
+		sort.Float64s(vals)
+
+		for _, q := range []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99} {
+			exact := vals[int(q*float64(len(vals)))]
+			got := h.Query(q)
+			if math.Abs(got-exact) > 0.1*exact {
+				t.Errorf("q=%v: got %v exact %v", q, got, exact)
+			}
+			assert.That(t, math.Abs(h.CDF(got)-q) < 1e-9)
+		}
+	})
+
+	t.Run("Sparse", func(t *testing.T) {
+		h := newTestHistogram(t, []float64{1, 1e100, 1e-100, 1, -5})
+		assert.Equal(t, h.Bins(), 4)
+		assert.Equal(t, h.Len(), int64(5))
+		assert.Equal(t, h.Query(0), -5.1)
+		assert.Equal(t, h.CDF(0), 0.2)
+		assert.Equal(t, h.CDF(1.1), 0.8)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		h := newTestHistogram(t, nil)
+		assert.Equal(t, h.Query(0.5), 0.0)
+		assert.Equal(t, h.CDF(0.5), 0.0)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		a := newTestHistogram(t, []float64{1, 2, 3, 300})
+		b := newTestHistogram(t, []float64{2, 0.5, 4000})
+		all := newTestHistogram(t, []float64{1, 2, 3, 300, 2, 0.5, 4000})
+
+		assert.NoError(t, a.Merge(b))
+		assert.DeepEqual(t, a.bins, all.bins)
+		assert.DeepEqual(t, a.counts, all.counts)
+		assert.Equal(t, a.Len(), all.Len())
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		h := newTestHistogram(t, nil)
+		h.ObserveWeighted(5, 10)
+		h.ObserveWeighted(50, 0)
+		assert.Equal(t, h.Len(), int64(10))
+		assert.Equal(t, h.Bins(), 1)
+	})
+
+	t.Run("Marshal", func(t *testing.T) {
+		h := newTestHistogram(t, []float64{-7, 0, 1, 1, 1e50, 12345})
+		data := h.Marshal(nil)
+
+		d, err := Params{}.Unmarshal(data)
+		assert.NoError(t, err)
+		assert.DeepEqual(t, d.(*Histogram).bins, h.bins)
+		assert.DeepEqual(t, d.(*Histogram).counts, h.counts)
+		assert.Equal(t, d.Len(), h.Len())
+
+		for i := 0; i < len(data); i++ {
+			_, err := Params{}.Unmarshal(data[:i])
+			assert.Error(t, err)
+		}
+	})
+}
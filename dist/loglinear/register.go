@@ -0,0 +1,17 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package loglinear
+
+import (
+	"context"
+
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/registry"
+)
+
+func init() {
+	registry.RegisterDistribution("loglinear", registry.DistributionMakerFunc(
+		func(ctx context.Context, config interface{}) (dist.Params, error) {
+			return Params{}, nil
+		}))
+}
@@ -0,0 +1,10 @@
+// Copyright (C) 2018. See AUTHORS.
+
+// package moments provides a moments sketch distribution.
+//
+// The sketch keeps the count, minimum, maximum and power sums of the observed
+// values, and so merges exactly by addition. Quantiles are estimated by the
+// maximum entropy distribution matching the moments. Since the power sums are
+// not shifted, precision is lost for values that are far from zero compared
+// to their range, and the sketch uses fewer moments in that case.
+package moments
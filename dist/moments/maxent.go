@@ -0,0 +1,339 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package moments
+
+import (
+	"math"
+
+	"github.com/zeebo/rothko/dist"
+)
+
+//
+// the maximum entropy solver finds the density on [min, max] with the largest
+// entropy whose moments match the sketch. after scaling to s in [-1, 1], the
+// density has the form exp(sum_j lambda_j T_j(s)) where T_j are the Chebyshev
+// polynomials, and lambda minimizes the convex dual
+//
+//	gamma(lambda) = integral(exp(sum_j lambda_j T_j(s))) - sum_j lambda_j mu_j
+//
+// where mu_j are the Chebyshev moments. we minimize it with a damped newton's
+// method using a fixed quadrature grid. if that fails to converge, we retry
+// with fewer moments, eventually falling back to the uniform distribution.
+//
+
+const (
+	// gridSize is the number of quadrature points on [-1, 1].
+	gridSize = 256
+
+	// maxIterations bounds the number of newton steps per attempt.
+	maxIterations = 100
+
+	// tolerance is the gradient norm at which the solver has converged.
+	tolerance = 1e-9
+
+	// maxCancellation bounds how large the terms summed to compute a scaled
+	// moment can be relative to the result before it is considered to be
+	// too imprecise to use.
+	maxCancellation = 1e8
+)
+
+// solution is the cached cdf of the maximum entropy distribution evaluated at
+// increasing points.
+type solution struct {
+	xs    []float64
+	cdf   []float64
+	table dist.Table
+}
+
+// solve computes the maximum entropy solution for the sketch values.
+func solve(count int64, min, max float64, sums []float64) *solution {
+	if count == 0 || !(min < max) {
+		return &solution{xs: []float64{min, max}, cdf: []float64{0, 1}}
+	}
+
+	mus := chebyshevMoments(count, min, max, sums)
+	grid := newGrid(2*len(mus) - 1)
+
+	var density []float64
+	for order := len(mus) - 1; order >= 0; order-- {
+		if density = grid.solve(mus[:order+1]); density != nil {
+			break
+		}
+	}
+
+	// integrate the density into a cdf with the trapezoid rule, and map the
+	// grid points back into the original range.
+	sol := &solution{
+		xs:  make([]float64, gridSize),
+		cdf: make([]float64, gridSize),
+	}
+	half := (max - min) / 2
+	for i, s := range grid.points {
+		sol.xs[i] = min + (s+1)*half
+		if i > 0 {
+			area := (density[i-1] + density[i]) / 2 * (s - grid.points[i-1])
+			sol.cdf[i] = sol.cdf[i-1] + area
+		}
+	}
+	total := sol.cdf[gridSize-1]
+	for i := range sol.cdf {
+		sol.cdf[i] /= total
+	}
+	sol.xs[gridSize-1] = max
+
+	return sol
+}
+
+// chebyshevMoments returns the Chebyshev moments of the values after they
+// are scaled into [-1, 1], keeping only the prefix that is precise and valid.
+// the zeroth moment is always 1.
+func chebyshevMoments(count int64, min, max float64, sums []float64) (
+	mus []float64) {
+
+	// raw[i] is the mean of x^i.
+	raw := make([]float64, len(sums)+1)
+	raw[0] = 1
+	for i, sum := range sums {
+		raw[i+1] = sum / float64(count)
+	}
+
+	// scaled[j] is the mean of s^j where s = a*x + b, by the binomial
+	// expansion. we track the magnitude of the terms to detect cancellation.
+	a, b := 2/(max-min), -(max+min)/(max-min)
+	scaled := make([]float64, len(raw))
+	for j := range raw {
+		sum, mag := 0.0, 0.0
+		binom := 1.0
+		for i := 0; i <= j; i++ {
+			term := binom * math.Pow(a, float64(i)) * raw[i] *
+				math.Pow(b, float64(j-i))
+			sum += term
+			mag += math.Abs(term)
+			binom = binom * float64(j-i) / float64(i+1)
+		}
+		if math.IsNaN(sum) || math.IsInf(mag, 0) || mag > maxCancellation {
+			break
+		}
+		scaled[j] = sum
+		mus = append(mus, 0)
+	}
+
+	// convert the power moments into Chebyshev moments using the recurrence
+	// T_{n+1}(s) = 2 s T_n(s) - T_{n-1}(s) on the polynomial coefficients.
+	prev, cur := []float64{1}, []float64{0, 1}
+	for j := range mus {
+		var coeffs []float64
+		switch j {
+		case 0:
+			coeffs = prev
+		case 1:
+			coeffs = cur
+		default:
+			next := make([]float64, j+1)
+			for i, c := range cur {
+				next[i+1] += 2 * c
+			}
+			for i, c := range prev {
+				next[i] -= c
+			}
+			prev, cur = cur, next
+			coeffs = next
+		}
+
+		for i, c := range coeffs {
+			mus[j] += c * scaled[i]
+		}
+
+		// the Chebyshev polynomials are bounded by 1 on [-1, 1], so any
+		// moment larger than that must be imprecise.
+		if math.Abs(mus[j]) > 1+1e-9 {
+			return mus[:j]
+		}
+	}
+
+	return mus
+}
+
+// grid contains the quadrature points and Chebyshev polynomials evaluated at
+// them.
+type grid struct {
+	points  []float64
+	weights []float64
+	polys   [][]float64 // polys[j][i] is T_j(points[i])
+}
+
+// newGrid constructs a grid with polynomials up to order-1.
+func newGrid(order int) *grid {
+	g := &grid{
+		points:  make([]float64, gridSize),
+		weights: make([]float64, gridSize),
+		polys:   make([][]float64, order),
+	}
+
+	step := 2 / float64(gridSize-1)
+	for i := range g.points {
+		g.points[i] = -1 + float64(i)*step
+		g.weights[i] = step
+	}
+	g.points[gridSize-1] = 1
+	g.weights[0] /= 2
+	g.weights[gridSize-1] /= 2
+
+	for j := range g.polys {
+		g.polys[j] = make([]float64, gridSize)
+		for i, s := range g.points {
+			switch j {
+			case 0:
+				g.polys[j][i] = 1
+			case 1:
+				g.polys[j][i] = s
+			default:
+				g.polys[j][i] = 2*s*g.polys[j-1][i] - g.polys[j-2][i]
+			}
+		}
+	}
+
+	return g
+}
+
+// density evaluates the density for lambda at every grid point into out.
+func (g *grid) density(lambda, out []float64) []float64 {
+	out = out[:0]
+	for i := range g.points {
+		exp := 0.0
+		for j, l := range lambda {
+			exp += l * g.polys[j][i]
+		}
+		out = append(out, math.Exp(exp))
+	}
+	return out
+}
+
+// dual evaluates the dual objective for lambda given the density.
+func (g *grid) dual(lambda, mus, density []float64) float64 {
+	val := 0.0
+	for i, d := range density {
+		val += g.weights[i] * d
+	}
+	for j, l := range lambda {
+		val -= l * mus[j]
+	}
+	return val
+}
+
+// solve returns the density at the grid points matching the moments, or nil
+// if the solver does not converge.
+func (g *grid) solve(mus []float64) []float64 {
+	k := len(mus)
+	lambda := make([]float64, k)
+	lambda[0] = math.Log(0.5) // the uniform density on [-1, 1]
+
+	ints := make([]float64, 2*k-1)
+	grad := make([]float64, k)
+	hess := make([]float64, k*k)
+	step := make([]float64, k)
+	next := make([]float64, k)
+	density := g.density(lambda, nil)
+	scratch := make([]float64, 0, gridSize)
+	val := g.dual(lambda, mus, density)
+
+	for iter := 0; iter < maxIterations; iter++ {
+		// compute the integrals of every polynomial against the density. the
+		// hessian only needs these because T_a T_b = (T_{a+b} + T_|a-b|) / 2.
+		for j := range ints {
+			sum := 0.0
+			for i, d := range density {
+				sum += g.weights[i] * g.polys[j][i] * d
+			}
+			ints[j] = sum
+		}
+
+		// compute the gradient and hessian of the dual
+		norm := 0.0
+		for a := 0; a < k; a++ {
+			grad[a] = ints[a] - mus[a]
+			norm += grad[a] * grad[a]
+
+			for b := 0; b <= a; b++ {
+				sum := (ints[a+b] + ints[a-b]) / 2
+				hess[a*k+b], hess[b*k+a] = sum, sum
+			}
+		}
+		if math.Sqrt(norm) < tolerance {
+			return density
+		}
+
+		if !cholesky(hess, grad, step, k) {
+			return nil
+		}
+
+		// backtrack until the dual decreases
+		t := 1.0
+		for ; t > 1e-10; t /= 2 {
+			for j := range next {
+				next[j] = lambda[j] - t*step[j]
+			}
+			scratch = g.density(next, scratch)
+			if next_val := g.dual(next, mus, scratch); next_val < val {
+				val = next_val
+				break
+			}
+		}
+		if t <= 1e-10 {
+			// no progress can be made. accept the solution if it is close.
+			if math.Sqrt(norm) < 1e-5 {
+				return density
+			}
+			return nil
+		}
+
+		lambda, next = next, lambda
+		density, scratch = scratch, density
+	}
+
+	return nil
+}
+
+// cholesky solves the symmetric positive definite system a x = b of size k
+// into x, returning false if it is not positive definite. a is overwritten.
+func cholesky(a, b, x []float64, k int) bool {
+	// decompose a into l l^T in place in the lower triangle
+	for j := 0; j < k; j++ {
+		sum := a[j*k+j]
+		for p := 0; p < j; p++ {
+			sum -= a[j*k+p] * a[j*k+p]
+		}
+		if !(sum > 0) {
+			return false
+		}
+		a[j*k+j] = math.Sqrt(sum)
+
+		for i := j + 1; i < k; i++ {
+			sum := a[i*k+j]
+			for p := 0; p < j; p++ {
+				sum -= a[i*k+p] * a[j*k+p]
+			}
+			a[i*k+j] = sum / a[j*k+j]
+		}
+	}
+
+	// forward substitution for l y = b
+	for i := 0; i < k; i++ {
+		sum := b[i]
+		for p := 0; p < i; p++ {
+			sum -= a[i*k+p] * x[p]
+		}
+		x[i] = sum / a[i*k+i]
+	}
+
+	// backward substitution for l^T x = y
+	for i := k - 1; i >= 0; i-- {
+		sum := x[i]
+		for p := i + 1; p < k; p++ {
+			sum -= a[p*k+i] * x[p]
+		}
+		x[i] = sum / a[i*k+i]
+	}
+
+	return true
+}
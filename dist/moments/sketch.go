@@ -0,0 +1,272 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package moments
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/zeebo/rothko/dist"
+)
+
+const (
+	// DefaultOrder is the number of power sums kept if the order is zero.
+	DefaultOrder = 10
+
+	// MaxOrder is the largest number of power sums a sketch can keep.
+	MaxOrder = 20
+)
+
+// encodingVersion is the version of the encoding written by Marshal.
+const encodingVersion = 1
+
+// Params implements dist.Params for a moments sketch.
+type Params struct {
+	// Order is the number of power sums to keep. If zero, DefaultOrder is
+	// used.
+	Order int
+}
+
+// Kind returns the moments distribution kind.
+func (p Params) Kind() string {
+	return "moments"
+}
+
+// New returns a new Sketch as a dist.Dist.
+func (p Params) New() (dist.Dist, error) {
+	order := p.Order
+	if order == 0 {
+		order = DefaultOrder
+	}
+	if order < 1 || order > MaxOrder {
+		return nil, dist.Error.New("invalid moments order: %d", order)
+	}
+	return newSketch(order), nil
+}
+
+// Unmarshal loads a dist.Dist out of some bytes.
+func (p Params) Unmarshal(data []byte) (dist.Dist, error) {
+	hdr, body, ok, err := dist.ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, dist.Error.New("moments encoding missing header")
+	}
+	if err := hdr.Check("moments", encodingVersion); err != nil {
+		return nil, err
+	}
+	if len(hdr.Params) < 1 {
+		return nil, dist.Error.New("moments header missing order")
+	}
+
+	order := int(hdr.Params[0])
+	if float64(order) != hdr.Params[0] || order < 1 || order > MaxOrder {
+		return nil, dist.Error.New("invalid moments order: %v", hdr.Params[0])
+	}
+	if len(body) != 8*(3+order) {
+		return nil, dist.Error.New("moments encoding has invalid length")
+	}
+
+	s := newSketch(order)
+	s.count = int64(binary.BigEndian.Uint64(body[0:8]))
+	s.min = math.Float64frombits(binary.BigEndian.Uint64(body[8:16]))
+	s.max = math.Float64frombits(binary.BigEndian.Uint64(body[16:24]))
+	for i := range s.sums {
+		bits := binary.BigEndian.Uint64(body[24+8*i:])
+		s.sums[i] = math.Float64frombits(bits)
+	}
+	if s.count < 0 {
+		return nil, dist.Error.New("moments encoding has negative count")
+	}
+
+	return s, nil
+}
+
+//
+// Sketch
+//
+
+// Sketch implements dist.Dist for a moments sketch.
+type Sketch struct {
+	count    int64
+	min, max float64
+	sums     []float64 // sums[i] is the sum of x^(i+1)
+
+	// solved is the cached maximum entropy solution. it is nil if it needs
+	// to be recomputed.
+	solved *solution
+}
+
+var (
+	// type assert the interfaces we expect to implement
+	_ dist.Dist             = (*Sketch)(nil)
+	_ dist.Merger           = (*Sketch)(nil)
+	_ dist.WeightedObserver = (*Sketch)(nil)
+	_ dist.Tabler           = (*Sketch)(nil)
+)
+
+// newSketch constructs a sketch keeping order power sums.
+func newSketch(order int) *Sketch {
+	return &Sketch{sums: make([]float64, order)}
+}
+
+// Kind returns the string "moments".
+func (s *Sketch) Kind() string {
+	return "moments"
+}
+
+// Order returns the number of power sums kept by the sketch.
+func (s *Sketch) Order() int {
+	return len(s.sums)
+}
+
+// Len returns how many observations there were.
+func (s *Sketch) Len() int64 {
+	return s.count
+}
+
+// Observe adds the value to the sketch.
+func (s *Sketch) Observe(val float64) {
+	s.ObserveWeighted(val, 1)
+}
+
+// ObserveWeighted adds the value to the sketch weight times.
+func (s *Sketch) ObserveWeighted(val float64, weight int64) {
+	if weight <= 0 || math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+
+	if s.count == 0 || val < s.min {
+		s.min = val
+	}
+	if s.count == 0 || val > s.max {
+		s.max = val
+	}
+	s.count += weight
+
+	w, pow := float64(weight), val
+	for i := range s.sums {
+		s.sums[i] += w * pow
+		pow *= val
+	}
+	s.solved = nil
+}
+
+// Merge adds the sums of the other sketch, which must keep at least as many
+// power sums as this sketch.
+func (s *Sketch) Merge(other dist.Dist) error {
+	os, ok := other.(*Sketch)
+	if !ok {
+		return dist.Error.New("cannot merge %q into moments", other.Kind())
+	}
+	if len(os.sums) < len(s.sums) {
+		return dist.Error.New("cannot merge moments of order %d into %d",
+			len(os.sums), len(s.sums))
+	}
+	if os.count == 0 {
+		return nil
+	}
+
+	if s.count == 0 || os.min < s.min {
+		s.min = os.min
+	}
+	if s.count == 0 || os.max > s.max {
+		s.max = os.max
+	}
+	s.count += os.count
+	for i := range s.sums {
+		s.sums[i] += os.sums[i]
+	}
+	s.solved = nil
+	return nil
+}
+
+// Marshal appends a byte form of the sketch to the provided buffer.
+func (s *Sketch) Marshal(buf []byte) []byte {
+	var scratch [8]byte
+
+	buf = dist.AppendHeader(buf, dist.Header{
+		Kind:    "moments",
+		Version: encodingVersion,
+		Params:  []float64{float64(len(s.sums))},
+	})
+
+	binary.BigEndian.PutUint64(scratch[:], uint64(s.count))
+	buf = append(buf, scratch[:]...)
+	binary.BigEndian.PutUint64(scratch[:], math.Float64bits(s.min))
+	buf = append(buf, scratch[:]...)
+	binary.BigEndian.PutUint64(scratch[:], math.Float64bits(s.max))
+	buf = append(buf, scratch[:]...)
+	for _, sum := range s.sums {
+		binary.BigEndian.PutUint64(scratch[:], math.Float64bits(sum))
+		buf = append(buf, scratch[:]...)
+	}
+
+	return buf
+}
+
+// solution returns the cached maximum entropy solution, computing it if
+// necessary.
+func (s *Sketch) solution() *solution {
+	if s.solved == nil {
+		s.solved = solve(s.count, s.min, s.max, s.sums)
+	}
+	return s.solved
+}
+
+// Query returns the estimated x'th quantile.
+func (s *Sketch) Query(x float64) float64 {
+	switch {
+	case s.count == 0:
+		return 0
+	case x <= 0 || s.min == s.max:
+		return s.min
+	case x >= 1:
+		return s.max
+	}
+
+	sol := s.solution()
+	i := sort.SearchFloat64s(sol.cdf, x)
+	if i == 0 {
+		return s.min
+	}
+	if i >= len(sol.cdf) {
+		return s.max
+	}
+
+	frac := (x - sol.cdf[i-1]) / (sol.cdf[i] - sol.cdf[i-1])
+	return sol.xs[i-1] + frac*(sol.xs[i]-sol.xs[i-1])
+}
+
+// CDF returns the estimated percentile of the value x.
+func (s *Sketch) CDF(x float64) float64 {
+	switch {
+	case s.count == 0 || x < s.min:
+		return 0
+	case x >= s.max:
+		return 1
+	}
+
+	sol := s.solution()
+	i := sort.SearchFloat64s(sol.xs, x)
+	if i == 0 {
+		return 0
+	}
+	if i >= len(sol.xs) {
+		return 1
+	}
+
+	frac := (x - sol.xs[i-1]) / (sol.xs[i] - sol.xs[i-1])
+	return sol.cdf[i-1] + frac*(sol.cdf[i]-sol.cdf[i-1])
+}
+
+// Table returns a table of quantiles for the sketch.
+func (s *Sketch) Table() dist.Table {
+	sol := s.solution()
+	if sol.table.Size() == 0 {
+		sol.table = dist.NewTable(s, dist.DefaultTableSize)
+	}
+	return sol.table
+}
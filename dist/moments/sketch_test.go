@@ -0,0 +1,125 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package moments
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func newTestSketch(t testing.TB, vals []float64) *Sketch {
+	d, err := Params{}.New()
+	assert.NoError(t, err)
+	for _, val := range vals {
+		d.Observe(val)
+	}
+	return d.(*Sketch)
+}
+
+func TestSketch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	check := func(t *testing.T, vals []float64, tol float64) {
+		s := newTestSketch(t, vals)
+		sort.Float64s(vals)
+
+		assert.Equal(t, s.Query(0), vals[0])
+		assert.Equal(t, s.Query(1), vals[len(vals)-1])
+
+		width := vals[len(vals)-1] - vals[0]
+		for _, q := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+			exact := vals[int(q*float64(len(vals)))]
+			got := s.Query(q)
+			if math.Abs(got-exact) > tol*width {
+				t.Errorf("q=%v: got %v exact %v", q, got, exact)
+			}
+			assert.That(t, math.Abs(s.CDF(got)-q) < 1e-3)
+		}
+	}
+
+	t.Run("Uniform", func(t *testing.T) {
+		vals := make([]float64, 10000)
+		for i := range vals {
+			vals[i] = rng.Float64() * 100
+		}
+		check(t, vals, 0.01)
+	})
+
+	t.Run("Normal", func(t *testing.T) {
+		vals := make([]float64, 10000)
+		for i := range vals {
+			vals[i] = rng.NormFloat64()*10 + 50
+		}
+		check(t, vals, 0.02)
+	})
+
+	t.Run("Exponential", func(t *testing.T) {
+		vals := make([]float64, 10000)
+		for i := range vals {
+			vals[i] = rng.ExpFloat64() * 10
+		}
+		check(t, vals, 0.02)
+	})
+
+	t.Run("Constant", func(t *testing.T) {
+		s := newTestSketch(t, []float64{5, 5, 5})
+		assert.Equal(t, s.Query(0.5), 5.0)
+		assert.Equal(t, s.CDF(5), 1.0)
+		assert.Equal(t, s.CDF(4), 0.0)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		s := newTestSketch(t, nil)
+		assert.Equal(t, s.Len(), int64(0))
+		assert.Equal(t, s.Query(0.5), 0.0)
+		assert.Equal(t, s.Table().Size(), 1024)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		a := newTestSketch(t, []float64{1, 2, 3})
+		b := newTestSketch(t, []float64{4, 5})
+		all := newTestSketch(t, []float64{1, 2, 3, 4, 5})
+
+		assert.NoError(t, a.Merge(b))
+		assert.DeepEqual(t, a.sums, all.sums)
+		assert.Equal(t, a.Len(), all.Len())
+		assert.Equal(t, a.min, 1.0)
+		assert.Equal(t, a.max, 5.0)
+	})
+
+	t.Run("Marshal", func(t *testing.T) {
+		s := newTestSketch(t, []float64{1, 2, 3, 4, 5})
+		data := s.Marshal(nil)
+
+		d, err := Params{}.Unmarshal(data)
+		assert.NoError(t, err)
+		assert.DeepEqual(t, d.(*Sketch).sums, s.sums)
+		assert.Equal(t, d.Len(), s.Len())
+
+		for i := 0; i < len(data); i++ {
+			_, err := Params{}.Unmarshal(data[:i])
+			assert.Error(t, err)
+		}
+	})
+}
+
+func BenchmarkSketch(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	vals := make([]float64, 1000)
+	for i := range vals {
+		vals[i] = rng.NormFloat64()*10 + 50
+	}
+	s := newTestSketch(b, vals)
+
+	b.Run("Solve", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.solved = nil
+			s.Query(0.5)
+		}
+	})
+}
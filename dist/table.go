@@ -0,0 +1,106 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package dist
+
+import "sort"
+
+// DefaultTableSize is a table size that is accurate enough for drawing.
+const DefaultTableSize = 1024
+
+// Table is a precomputed table of evenly spaced quantiles of a distribution.
+// The values in the table are monotonically non-decreasing, so it can
+// estimate the CDF with a binary search and linear interpolation.
+type Table struct {
+	values []float64
+}
+
+// NewTable queries size+1 evenly spaced quantiles from the distribution into
+// a Table. Any non-monotone values returned by the distribution are clamped
+// to the previous value. The size must be at least 1.
+func NewTable(d Dist, size int) Table {
+	if size < 1 {
+		size = 1
+	}
+
+	values := make([]float64, size+1)
+	for i := range values {
+		val := d.Query(float64(i) / float64(size))
+		if i > 0 && val < values[i-1] {
+			val = values[i-1]
+		}
+		values[i] = val
+	}
+
+	return Table{values: values}
+}
+
+// Size returns the number of evenly spaced intervals in the table. The zero
+// value has size zero.
+func (t Table) Size() int {
+	if len(t.values) == 0 {
+		return 0
+	}
+	return len(t.values) - 1
+}
+
+// Query returns the value for the x'th percentile, interpolating between
+// entries in the table. The percentile is represented as a number in [0, 1].
+func (t Table) Query(x float64) float64 {
+	size := t.Size()
+	switch {
+	case size == 0:
+		return 0
+	case x <= 0:
+		return t.values[0]
+	case x >= 1:
+		return t.values[size]
+	}
+
+	pos := x * float64(size)
+	i := int(pos)
+	if i >= size {
+		return t.values[size]
+	}
+	frac := pos - float64(i)
+	return t.values[i] + frac*(t.values[i+1]-t.values[i])
+}
+
+// CDF returns the percentile for the given value, using a binary search over
+// the table. The percentile is represented as a number in [0, 1].
+func (t Table) CDF(x float64) float64 {
+	size := t.Size()
+	switch {
+	case size == 0:
+		return 0
+	case x < t.values[0]:
+		return 0
+	case x >= t.values[size]:
+		return 1
+	}
+
+	// hi is the first entry strictly larger than x. it must exist and be
+	// positive due to the bounds checks above.
+	hi := sort.Search(len(t.values), func(i int) bool {
+		return t.values[i] > x
+	})
+	lo := hi - 1
+
+	frac := (x - t.values[lo]) / (t.values[hi] - t.values[lo])
+	return (float64(lo) + frac) / float64(size)
+}
+
+// Tabler is an optional interface a Dist can implement to provide a cached
+// Table of its quantiles.
+type Tabler interface {
+	// Table returns a Table of the quantiles of the distribution.
+	Table() Table
+}
+
+// TableOf returns a Table for the Dist, using the Dist's cached table if it
+// implements Tabler, and computing one of DefaultTableSize otherwise.
+func TableOf(d Dist) Table {
+	if tabler, ok := d.(Tabler); ok {
+		return tabler.Table()
+	}
+	return NewTable(d, DefaultTableSize)
+}
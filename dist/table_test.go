@@ -0,0 +1,51 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package dist
+
+import (
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+// linearDist is a uniform distribution on [0, 100] with a glitch in its
+// quantile function so that it is not monotone.
+type linearDist struct{ Dist }
+
+func (linearDist) Query(x float64) float64 {
+	if x == 0.5 {
+		return 0
+	}
+	return x * 100
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable(linearDist{}, 100)
+	assert.Equal(t, table.Size(), 100)
+
+	t.Run("Monotone", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			x0 := float64(i) / 100
+			x1 := float64(i+1) / 100
+			assert.That(t, table.Query(x0) <= table.Query(x1))
+		}
+	})
+
+	t.Run("CDF", func(t *testing.T) {
+		assert.Equal(t, table.CDF(-1), 0.0)
+		assert.Equal(t, table.CDF(100), 1.0)
+		assert.Equal(t, table.CDF(1000), 1.0)
+		assert.Equal(t, table.CDF(25), 0.25)
+		assert.Equal(t, table.CDF(75.5), 0.755)
+
+		// the clamped glitch makes a plateau, and the cdf is its top
+		assert.Equal(t, table.CDF(49), 0.5)
+	})
+
+	t.Run("Zero", func(t *testing.T) {
+		var table Table
+		assert.Equal(t, table.Size(), 0)
+		assert.Equal(t, table.Query(0.5), 0.0)
+		assert.Equal(t, table.CDF(0.5), 0.0)
+	})
+}
@@ -3,11 +3,19 @@
 package tdigest
 
 import (
+	"encoding/binary"
+	"math"
+
 	"github.com/zeebo/rothko/dist"
 	"github.com/zeebo/errs"
 	"github.com/zeebo/tdigest"
 )
 
+// encodingVersion is the version of the encoding written by Marshal. Version
+// 0 is a bare t-digest encoding from before dist headers existed. Version 1
+// adds a dist header with the compression as the only parameter.
+const encodingVersion = 1
+
 // Params implements dist.Params for a t-digest distribution.
 type Params struct {
 	Compression float64
@@ -23,16 +31,66 @@ func (p Params) New() (dist.Dist, error) {
 	if p.Compression == 0 {
 		return nil, errs.New("New called on zero value Params")
 	}
-	return Wrap(tdigest.New(p.Compression)), nil
+	return Wrap(tdigest.New(p.Compression), p.Compression), nil
 }
 
-// Unmarshal loads a dist.Dist out of some bytes.
+// Unmarshal loads a dist.Dist out of some bytes. It accepts any encoding
+// version up to the one written by Marshal, and returns an error for data
+// of another kind or a newer version.
 func (p Params) Unmarshal(data []byte) (dist.Dist, error) {
-	dist, err := tdigest.FromBytes(data)
+	hdr, body, ok, err := dist.ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		hdr = dist.Header{Kind: "tdigest", Version: 0}
+	}
+	if err := hdr.Check("tdigest", encodingVersion); err != nil {
+		return nil, err
+	}
+
+	td, err := fromBytes(body)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
-	return Wrap(dist), nil
+
+	// the t-digest encoding contains the compression after its version.
+	// version 1 and above must agree with it in the header.
+	compression := math.Float64frombits(binary.BigEndian.Uint64(body[4:12]))
+	if hdr.Version >= 1 {
+		if len(hdr.Params) < 1 {
+			return nil, dist.Error.New("tdigest header missing compression")
+		}
+		if hdr.Params[0] != compression {
+			return nil, dist.Error.New("tdigest compression mismatch: "+
+				"header has %v but encoding has %v",
+				hdr.Params[0], compression)
+		}
+	}
+
+	return Wrap(td, compression), nil
+}
+
+// fromBytes is a wrapper around tdigest.FromBytes that returns errors for
+// truncated data rather than panicking.
+func fromBytes(data []byte) (td *tdigest.TDigest, err error) {
+	// the smallest t-digest encoding is a 4 byte version, an 8 byte
+	// compression, and a 4 byte number of centroids.
+	if len(data) < 16 {
+		return nil, dist.Error.New("tdigest encoding truncated")
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			td, err = nil, dist.Error.New("tdigest encoding corrupt: %v", rec)
+		}
+	}()
+
+	td, err = tdigest.FromBytes(data)
+	if err != nil {
+		return nil, dist.Error.Wrap(err)
+	}
+	return td, nil
 }
 
 //
@@ -41,13 +99,24 @@ func (p Params) Unmarshal(data []byte) (dist.Dist, error) {
 
 // Wrapper implements dist.Dist for a t-digest.
 type Wrapper struct {
-	td    *tdigest.TDigest
-	cache map[float64]float64
+	td          *tdigest.TDigest
+	compression float64
+	table       dist.Table
 }
 
-// Wrap wraps the given t-digest.
-func Wrap(td *tdigest.TDigest) *Wrapper {
-	return &Wrapper{td: td}
+var (
+	// type assert the interfaces we expect to implement
+	_ dist.Dist             = (*Wrapper)(nil)
+	_ dist.Merger           = (*Wrapper)(nil)
+	_ dist.WeightedObserver = (*Wrapper)(nil)
+	_ dist.ExactCDFer       = (*Wrapper)(nil)
+	_ dist.Tabler           = (*Wrapper)(nil)
+)
+
+// Wrap wraps the given t-digest that was created with the compression. The
+// compression is recorded in the header when marshaling.
+func Wrap(td *tdigest.TDigest, compression float64) *Wrapper {
+	return &Wrapper{td: td, compression: compression}
 }
 
 // Underlying returns the underlying t-digest.
@@ -61,12 +130,42 @@ func (Wrapper) Kind() string {
 }
 
 // Observe adds the value to the t-digest.
-func (w Wrapper) Observe(val float64) {
+func (w *Wrapper) Observe(val float64) {
 	w.td.Add(val)
+	w.table = dist.Table{}
+}
+
+// ObserveWeighted adds the value to the t-digest weight times.
+func (w *Wrapper) ObserveWeighted(val float64, weight int64) {
+	for weight > 0 {
+		chunk := weight
+		if chunk > math.MaxUint32 {
+			chunk = math.MaxUint32
+		}
+		w.td.AddWeighted(val, uint32(chunk))
+		weight -= chunk
+	}
+	w.table = dist.Table{}
+}
+
+// Merge adds all of the observations from the other t-digest.
+func (w *Wrapper) Merge(other dist.Dist) error {
+	ow, ok := other.(*Wrapper)
+	if !ok {
+		return errs.New("cannot merge %q into tdigest", other.Kind())
+	}
+	w.table = dist.Table{}
+	return errs.Wrap(w.td.Merge(ow.td))
 }
 
-// Marshal appends a byte form of the t-digest to the provided buffer.
+// Marshal appends a byte form of the t-digest to the provided buffer. The
+// form starts with a dist.Header.
 func (w Wrapper) Marshal(buf []byte) []byte {
+	buf = dist.AppendHeader(buf, dist.Header{
+		Kind:    "tdigest",
+		Version: encodingVersion,
+		Params:  []float64{w.compression},
+	})
 	return w.td.Marshal(buf)
 }
 
@@ -75,48 +174,25 @@ func (w Wrapper) Query(x float64) float64 {
 	return w.td.Quantile(x)
 }
 
-// quan is a wrapper to memoize queried qualtile values for quickly estimating
-// the CDF.
-func (w *Wrapper) quan(x float64) float64 {
-	if w.cache == nil {
-		w.cache = make(map[float64]float64)
-	}
-	if val, ok := w.cache[x]; ok {
-		return val
+// Table returns a table of quantiles for the t-digest. It is computed once
+// and cached until more values are observed.
+func (w *Wrapper) Table() dist.Table {
+	if w.table.Size() == 0 {
+		w.table = dist.NewTable(w, dist.DefaultTableSize)
 	}
-	val := w.td.Quantile(x)
-	w.cache[x] = val
-	return val
+	return w.table
 }
 
-// CDF returns the estimate CDF at the value x.
+// CDF returns the estimate CDF at the value x. It binary searches a cached
+// table of quantiles, which is accurate to about 1/dist.DefaultTableSize and
+// is much faster than ExactCDF when called many times.
 func (w *Wrapper) CDF(x float64) float64 {
-	// TODO(jeff): CDF actually works, but i think it's way slower and this is
-	// basically just as accurate since we only have ~256 colors. essentially,
-	// we only have to do ~8 calls to quantile, rather than ~samples calls to
-	// CDF.
-
-	// return w.td.CDF(x)
-
-	min, max := w.quan(0), w.quan(1)
-	if x <= min {
-		return 0
-	}
-	if x >= max {
-		return 1
-	}
+	return w.Table().CDF(x)
+}
 
-	minq, maxq := 0.0, 1.0
-	for i := 0; i < 6; i++ {
-		medq := (minq + maxq) / 2
-		val := w.quan(medq)
-		if x >= val {
-			minq = medq
-		} else {
-			maxq = medq
-		}
-	}
-	return (minq + maxq) / 2
+// ExactCDF returns the CDF at the value x as computed by the t-digest.
+func (w *Wrapper) ExactCDF(x float64) float64 {
+	return w.td.CDF(x)
 }
 
 // Len returns how many items were added to the t-digest.
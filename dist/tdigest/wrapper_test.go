@@ -0,0 +1,83 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package tdigest
+
+import (
+	"testing"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/tdigest"
+)
+
+func TestWrapper(t *testing.T) {
+	params := Params{Compression: 5}
+
+	newData := func(t *testing.T) []byte {
+		d, err := params.New()
+		assert.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			d.Observe(float64(i))
+		}
+		return d.Marshal(nil)
+	}
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		data := newData(t)
+
+		hdr, _, ok, err := dist.ParseHeader(data)
+		assert.NoError(t, err)
+		assert.That(t, ok)
+		assert.Equal(t, hdr.Kind, "tdigest")
+		assert.Equal(t, hdr.Version, uint8(encodingVersion))
+		assert.DeepEqual(t, hdr.Params, []float64{5})
+
+		d, err := params.Unmarshal(data)
+		assert.NoError(t, err)
+		assert.Equal(t, d.Len(), int64(100))
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		td := tdigest.New(5)
+		for i := 0; i < 100; i++ {
+			td.Add(float64(i))
+		}
+
+		d, err := params.Unmarshal(td.Marshal(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, d.Len(), int64(100))
+
+		// remarshaling upgrades to the current version
+		hdr, _, ok, err := dist.ParseHeader(d.Marshal(nil))
+		assert.NoError(t, err)
+		assert.That(t, ok)
+		assert.DeepEqual(t, hdr.Params, []float64{5})
+	})
+
+	t.Run("Newer Version", func(t *testing.T) {
+		_, body, _, err := dist.ParseHeader(newData(t))
+		assert.NoError(t, err)
+
+		data := dist.AppendHeader(nil, dist.Header{
+			Kind:    "tdigest",
+			Version: encodingVersion + 1,
+			Params:  []float64{5},
+		})
+		_, err = params.Unmarshal(append(data, body...))
+		assert.Error(t, err)
+	})
+
+	t.Run("Wrong Kind", func(t *testing.T) {
+		data := dist.AppendHeader(nil, dist.Header{Kind: "other"})
+		_, err := params.Unmarshal(data)
+		assert.Error(t, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := newData(t)
+		for i := 0; i < len(data)-1; i++ {
+			_, err := params.Unmarshal(data[:i])
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,268 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package colors
+
+import (
+	"github.com/zeebo/rothko/draw"
+)
+
+// Diverging is a blue to white to red color map for drawing differences,
+// where the middle color means no difference.
+var Diverging = []draw.Color{
+	{R: 0x5, G: 0x30, B: 0x61},
+	{R: 0x6, G: 0x32, B: 0x64},
+	{R: 0x7, G: 0x34, B: 0x67},
+	{R: 0x8, G: 0x36, B: 0x6a},
+	{R: 0x9, G: 0x38, B: 0x6d},
+	{R: 0xa, G: 0x3b, B: 0x70},
+	{R: 0xc, G: 0x3d, B: 0x73},
+	{R: 0xd, G: 0x3f, B: 0x76},
+	{R: 0xe, G: 0x41, B: 0x79},
+	{R: 0xf, G: 0x43, B: 0x7b},
+	{R: 0x10, G: 0x45, B: 0x7e},
+	{R: 0x11, G: 0x47, B: 0x81},
+	{R: 0x12, G: 0x49, B: 0x84},
+	{R: 0x13, G: 0x4c, B: 0x87},
+	{R: 0x14, G: 0x4e, B: 0x8a},
+	{R: 0x15, G: 0x50, B: 0x8d},
+	{R: 0x17, G: 0x52, B: 0x90},
+	{R: 0x18, G: 0x54, B: 0x93},
+	{R: 0x19, G: 0x56, B: 0x96},
+	{R: 0x1a, G: 0x58, B: 0x99},
+	{R: 0x1b, G: 0x5a, B: 0x9c},
+	{R: 0x1c, G: 0x5c, B: 0x9f},
+	{R: 0x1d, G: 0x5f, B: 0xa2},
+	{R: 0x1e, G: 0x61, B: 0xa5},
+	{R: 0x1f, G: 0x63, B: 0xa8},
+	{R: 0x20, G: 0x65, B: 0xab},
+	{R: 0x22, G: 0x67, B: 0xac},
+	{R: 0x23, G: 0x69, B: 0xad},
+	{R: 0x24, G: 0x6a, B: 0xae},
+	{R: 0x26, G: 0x6c, B: 0xaf},
+	{R: 0x27, G: 0x6e, B: 0xb0},
+	{R: 0x28, G: 0x70, B: 0xb1},
+	{R: 0x2a, G: 0x71, B: 0xb2},
+	{R: 0x2b, G: 0x73, B: 0xb3},
+	{R: 0x2c, G: 0x75, B: 0xb4},
+	{R: 0x2e, G: 0x77, B: 0xb5},
+	{R: 0x2f, G: 0x79, B: 0xb5},
+	{R: 0x30, G: 0x7a, B: 0xb6},
+	{R: 0x32, G: 0x7c, B: 0xb7},
+	{R: 0x33, G: 0x7e, B: 0xb8},
+	{R: 0x34, G: 0x80, B: 0xb9},
+	{R: 0x36, G: 0x81, B: 0xba},
+	{R: 0x37, G: 0x83, B: 0xbb},
+	{R: 0x38, G: 0x85, B: 0xbc},
+	{R: 0x3a, G: 0x87, B: 0xbd},
+	{R: 0x3b, G: 0x88, B: 0xbe},
+	{R: 0x3c, G: 0x8a, B: 0xbe},
+	{R: 0x3e, G: 0x8c, B: 0xbf},
+	{R: 0x3f, G: 0x8e, B: 0xc0},
+	{R: 0x40, G: 0x8f, B: 0xc1},
+	{R: 0x42, G: 0x91, B: 0xc2},
+	{R: 0x43, G: 0x93, B: 0xc3},
+	{R: 0x46, G: 0x95, B: 0xc4},
+	{R: 0x49, G: 0x97, B: 0xc5},
+	{R: 0x4c, G: 0x99, B: 0xc6},
+	{R: 0x4f, G: 0x9b, B: 0xc7},
+	{R: 0x52, G: 0x9d, B: 0xc8},
+	{R: 0x56, G: 0x9f, B: 0xc9},
+	{R: 0x59, G: 0xa1, B: 0xca},
+	{R: 0x5c, G: 0xa3, B: 0xcb},
+	{R: 0x5f, G: 0xa5, B: 0xcd},
+	{R: 0x62, G: 0xa7, B: 0xce},
+	{R: 0x65, G: 0xa9, B: 0xcf},
+	{R: 0x68, G: 0xab, B: 0xd0},
+	{R: 0x6b, G: 0xac, B: 0xd1},
+	{R: 0x6e, G: 0xae, B: 0xd2},
+	{R: 0x71, G: 0xb0, B: 0xd3},
+	{R: 0x75, G: 0xb2, B: 0xd4},
+	{R: 0x78, G: 0xb4, B: 0xd5},
+	{R: 0x7b, G: 0xb6, B: 0xd6},
+	{R: 0x7e, G: 0xb8, B: 0xd7},
+	{R: 0x81, G: 0xba, B: 0xd8},
+	{R: 0x84, G: 0xbc, B: 0xd9},
+	{R: 0x87, G: 0xbe, B: 0xda},
+	{R: 0x8a, G: 0xc0, B: 0xdb},
+	{R: 0x8d, G: 0xc2, B: 0xdc},
+	{R: 0x90, G: 0xc4, B: 0xdd},
+	{R: 0x93, G: 0xc6, B: 0xde},
+	{R: 0x96, G: 0xc7, B: 0xdf},
+	{R: 0x98, G: 0xc8, B: 0xe0},
+	{R: 0x9b, G: 0xc9, B: 0xe0},
+	{R: 0x9d, G: 0xcb, B: 0xe1},
+	{R: 0xa0, G: 0xcc, B: 0xe2},
+	{R: 0xa2, G: 0xcd, B: 0xe3},
+	{R: 0xa5, G: 0xce, B: 0xe3},
+	{R: 0xa7, G: 0xd0, B: 0xe4},
+	{R: 0xa9, G: 0xd1, B: 0xe5},
+	{R: 0xac, G: 0xd2, B: 0xe5},
+	{R: 0xae, G: 0xd3, B: 0xe6},
+	{R: 0xb1, G: 0xd5, B: 0xe7},
+	{R: 0xb3, G: 0xd6, B: 0xe8},
+	{R: 0xb6, G: 0xd7, B: 0xe8},
+	{R: 0xb8, G: 0xd8, B: 0xe9},
+	{R: 0xbb, G: 0xda, B: 0xea},
+	{R: 0xbd, G: 0xdb, B: 0xea},
+	{R: 0xc0, G: 0xdc, B: 0xeb},
+	{R: 0xc2, G: 0xdd, B: 0xec},
+	{R: 0xc5, G: 0xdf, B: 0xec},
+	{R: 0xc7, G: 0xe0, B: 0xed},
+	{R: 0xca, G: 0xe1, B: 0xee},
+	{R: 0xcc, G: 0xe2, B: 0xef},
+	{R: 0xcf, G: 0xe4, B: 0xef},
+	{R: 0xd1, G: 0xe5, B: 0xf0},
+	{R: 0xd2, G: 0xe6, B: 0xf0},
+	{R: 0xd4, G: 0xe6, B: 0xf1},
+	{R: 0xd5, G: 0xe7, B: 0xf1},
+	{R: 0xd7, G: 0xe8, B: 0xf1},
+	{R: 0xd8, G: 0xe9, B: 0xf1},
+	{R: 0xda, G: 0xe9, B: 0xf2},
+	{R: 0xdb, G: 0xea, B: 0xf2},
+	{R: 0xdd, G: 0xeb, B: 0xf2},
+	{R: 0xde, G: 0xeb, B: 0xf2},
+	{R: 0xe0, G: 0xec, B: 0xf3},
+	{R: 0xe1, G: 0xed, B: 0xf3},
+	{R: 0xe3, G: 0xed, B: 0xf3},
+	{R: 0xe4, G: 0xee, B: 0xf4},
+	{R: 0xe6, G: 0xef, B: 0xf4},
+	{R: 0xe7, G: 0xf0, B: 0xf4},
+	{R: 0xe9, G: 0xf0, B: 0xf4},
+	{R: 0xea, G: 0xf1, B: 0xf5},
+	{R: 0xec, G: 0xf2, B: 0xf5},
+	{R: 0xed, G: 0xf2, B: 0xf5},
+	{R: 0xef, G: 0xf3, B: 0xf5},
+	{R: 0xf0, G: 0xf4, B: 0xf6},
+	{R: 0xf2, G: 0xf5, B: 0xf6},
+	{R: 0xf3, G: 0xf5, B: 0xf6},
+	{R: 0xf5, G: 0xf6, B: 0xf7},
+	{R: 0xf6, G: 0xf7, B: 0xf7},
+	{R: 0xf7, G: 0xf6, B: 0xf6},
+	{R: 0xf7, G: 0xf5, B: 0xf4},
+	{R: 0xf8, G: 0xf4, B: 0xf2},
+	{R: 0xf8, G: 0xf3, B: 0xf0},
+	{R: 0xf8, G: 0xf2, B: 0xef},
+	{R: 0xf8, G: 0xf1, B: 0xed},
+	{R: 0xf9, G: 0xf0, B: 0xeb},
+	{R: 0xf9, G: 0xef, B: 0xe9},
+	{R: 0xf9, G: 0xee, B: 0xe7},
+	{R: 0xf9, G: 0xed, B: 0xe5},
+	{R: 0xf9, G: 0xeb, B: 0xe3},
+	{R: 0xfa, G: 0xea, B: 0xe1},
+	{R: 0xfa, G: 0xe9, B: 0xdf},
+	{R: 0xfa, G: 0xe8, B: 0xde},
+	{R: 0xfa, G: 0xe7, B: 0xdc},
+	{R: 0xfb, G: 0xe6, B: 0xda},
+	{R: 0xfb, G: 0xe5, B: 0xd8},
+	{R: 0xfb, G: 0xe4, B: 0xd6},
+	{R: 0xfb, G: 0xe3, B: 0xd4},
+	{R: 0xfc, G: 0xe2, B: 0xd2},
+	{R: 0xfc, G: 0xe0, B: 0xd0},
+	{R: 0xfc, G: 0xdf, B: 0xcf},
+	{R: 0xfc, G: 0xde, B: 0xcd},
+	{R: 0xfd, G: 0xdd, B: 0xcb},
+	{R: 0xfd, G: 0xdc, B: 0xc9},
+	{R: 0xfd, G: 0xdb, B: 0xc7},
+	{R: 0xfd, G: 0xd9, B: 0xc4},
+	{R: 0xfc, G: 0xd7, B: 0xc2},
+	{R: 0xfc, G: 0xd5, B: 0xbf},
+	{R: 0xfc, G: 0xd3, B: 0xbc},
+	{R: 0xfb, G: 0xd0, B: 0xb9},
+	{R: 0xfb, G: 0xce, B: 0xb7},
+	{R: 0xfb, G: 0xcc, B: 0xb4},
+	{R: 0xfa, G: 0xca, B: 0xb1},
+	{R: 0xfa, G: 0xc8, B: 0xaf},
+	{R: 0xf9, G: 0xc6, B: 0xac},
+	{R: 0xf9, G: 0xc4, B: 0xa9},
+	{R: 0xf9, G: 0xc2, B: 0xa7},
+	{R: 0xf8, G: 0xbf, B: 0xa4},
+	{R: 0xf8, G: 0xbd, B: 0xa1},
+	{R: 0xf8, G: 0xbb, B: 0x9e},
+	{R: 0xf7, G: 0xb9, B: 0x9c},
+	{R: 0xf7, G: 0xb7, B: 0x99},
+	{R: 0xf7, G: 0xb5, B: 0x96},
+	{R: 0xf6, G: 0xb3, B: 0x94},
+	{R: 0xf6, G: 0xb1, B: 0x91},
+	{R: 0xf6, G: 0xaf, B: 0x8e},
+	{R: 0xf5, G: 0xac, B: 0x8b},
+	{R: 0xf5, G: 0xaa, B: 0x89},
+	{R: 0xf5, G: 0xa8, B: 0x86},
+	{R: 0xf4, G: 0xa6, B: 0x83},
+	{R: 0xf3, G: 0xa4, B: 0x81},
+	{R: 0xf2, G: 0xa1, B: 0x7f},
+	{R: 0xf1, G: 0x9e, B: 0x7d},
+	{R: 0xf0, G: 0x9c, B: 0x7b},
+	{R: 0xef, G: 0x99, B: 0x79},
+	{R: 0xee, G: 0x96, B: 0x77},
+	{R: 0xec, G: 0x93, B: 0x74},
+	{R: 0xeb, G: 0x91, B: 0x72},
+	{R: 0xea, G: 0x8e, B: 0x70},
+	{R: 0xe9, G: 0x8b, B: 0x6e},
+	{R: 0xe8, G: 0x89, B: 0x6c},
+	{R: 0xe6, G: 0x86, B: 0x6a},
+	{R: 0xe5, G: 0x83, B: 0x68},
+	{R: 0xe4, G: 0x80, B: 0x66},
+	{R: 0xe3, G: 0x7e, B: 0x64},
+	{R: 0xe2, G: 0x7b, B: 0x62},
+	{R: 0xe1, G: 0x78, B: 0x60},
+	{R: 0xdf, G: 0x76, B: 0x5e},
+	{R: 0xde, G: 0x73, B: 0x5c},
+	{R: 0xdd, G: 0x70, B: 0x59},
+	{R: 0xdc, G: 0x6e, B: 0x57},
+	{R: 0xdb, G: 0x6b, B: 0x55},
+	{R: 0xda, G: 0x68, B: 0x53},
+	{R: 0xd8, G: 0x65, B: 0x51},
+	{R: 0xd7, G: 0x63, B: 0x4f},
+	{R: 0xd6, G: 0x60, B: 0x4d},
+	{R: 0xd5, G: 0x5d, B: 0x4c},
+	{R: 0xd3, G: 0x5a, B: 0x4a},
+	{R: 0xd2, G: 0x58, B: 0x49},
+	{R: 0xd0, G: 0x55, B: 0x48},
+	{R: 0xcf, G: 0x52, B: 0x46},
+	{R: 0xce, G: 0x4f, B: 0x45},
+	{R: 0xcc, G: 0x4c, B: 0x44},
+	{R: 0xcb, G: 0x49, B: 0x42},
+	{R: 0xc9, G: 0x47, B: 0x41},
+	{R: 0xc8, G: 0x44, B: 0x40},
+	{R: 0xc6, G: 0x41, B: 0x3e},
+	{R: 0xc5, G: 0x3e, B: 0x3d},
+	{R: 0xc4, G: 0x3b, B: 0x3c},
+	{R: 0xc2, G: 0x38, B: 0x3a},
+	{R: 0xc1, G: 0x36, B: 0x39},
+	{R: 0xbf, G: 0x33, B: 0x38},
+	{R: 0xbe, G: 0x30, B: 0x36},
+	{R: 0xbd, G: 0x2d, B: 0x35},
+	{R: 0xbb, G: 0x2a, B: 0x34},
+	{R: 0xba, G: 0x28, B: 0x32},
+	{R: 0xb8, G: 0x25, B: 0x31},
+	{R: 0xb7, G: 0x22, B: 0x30},
+	{R: 0xb6, G: 0x1f, B: 0x2e},
+	{R: 0xb4, G: 0x1c, B: 0x2d},
+	{R: 0xb3, G: 0x19, B: 0x2c},
+	{R: 0xb1, G: 0x18, B: 0x2b},
+	{R: 0xae, G: 0x17, B: 0x2a},
+	{R: 0xab, G: 0x16, B: 0x2a},
+	{R: 0xa8, G: 0x15, B: 0x29},
+	{R: 0xa5, G: 0x14, B: 0x29},
+	{R: 0xa2, G: 0x13, B: 0x28},
+	{R: 0x9f, G: 0x12, B: 0x28},
+	{R: 0x9c, G: 0x11, B: 0x27},
+	{R: 0x99, G: 0x10, B: 0x27},
+	{R: 0x96, G: 0xf, B: 0x27},
+	{R: 0x93, G: 0xe, B: 0x26},
+	{R: 0x90, G: 0xd, B: 0x26},
+	{R: 0x8d, G: 0xc, B: 0x25},
+	{R: 0x8a, G: 0xb, B: 0x25},
+	{R: 0x87, G: 0xa, B: 0x24},
+	{R: 0x84, G: 0x9, B: 0x24},
+	{R: 0x81, G: 0x8, B: 0x23},
+	{R: 0x7f, G: 0x8, B: 0x23},
+	{R: 0x7c, G: 0x7, B: 0x22},
+	{R: 0x79, G: 0x6, B: 0x22},
+	{R: 0x76, G: 0x5, B: 0x21},
+	{R: 0x73, G: 0x4, B: 0x21},
+	{R: 0x70, G: 0x3, B: 0x20},
+	{R: 0x6d, G: 0x2, B: 0x20},
+	{R: 0x6a, G: 0x1, B: 0x1f},
+	{R: 0x67, G: 0x0, B: 0x1f},
+}
@@ -15,11 +15,14 @@ type Canvas interface {
 
 // Column represents a column to draw in a context. Data is expected to be
 // sorted, non-empty, and contain typical floats (no NaNs/denormals/Inf/etc).
-// Obs is the number of observations.
+// Obs is the number of observations. Quantiles are the increasing quantiles
+// in [0, 1] that Data was sampled at. If nil, Data was sampled at evenly
+// spaced quantiles from 0 to 1.
 type Column struct {
-	X, W   int
-	Data   []float64
-	ObsSec float64
+	X, W      int
+	Data      []float64
+	Quantiles []float64
+	ObsSec    float64
 }
 
 // Color is a simple 8 bits per channel color.
@@ -70,10 +73,11 @@ func (m *RGB) Raw(x, y int) []uint8 {
 	return m.Pix[i : i+4]
 }
 
-// View returns a view into the RGB.
+// View returns a view into the RGB. The coordinates are relative to the RGB,
+// so views can be nested.
 func (m RGB) View(x, y, w, h int) *RGB {
-	m.X = x
-	m.Y = y
+	m.X += x
+	m.Y += y
 	m.Width = w
 	m.Height = h
 	return &m
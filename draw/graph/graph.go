@@ -5,6 +5,7 @@ package graph
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/zeebo/rothko/dist"
@@ -46,7 +47,8 @@ type Measured struct {
 	X, Y int
 
 	// internal state
-	opts MeasureOptions
+	opts  MeasureOptions
+	table dist.Table
 }
 
 // MeasureOptions are options for the graph to be measured.
@@ -54,6 +56,11 @@ type MeasureOptions struct {
 	// Earliest is the distribution for the earliest (closest to Now) column.
 	Earliest dist.Dist
 
+	// ExactCDF causes the heatmap colors to be computed with the exact CDF
+	// of the Earliest distribution if it provides one, instead of a binary
+	// search over a table of its quantiles.
+	ExactCDF bool
+
 	// What time the far right of the graph represents.
 	Now int64
 
@@ -121,12 +128,15 @@ func tryMeasure(ctx context.Context, opts MeasureOptions,
 
 	// measure the right axis
 	var right axis.Measured
+	var table dist.Table
 
 	if opts.Earliest != nil {
+		table = dist.TableOf(opts.Earliest)
+
 		labels = labels[:0]
 		for y := 0; y <= height-labelGap; y += labelGap {
 			pos := float64(y) / float64(height)
-			val := opts.Earliest.Query(1 - pos)
+			val := table.Query(1 - pos)
 			if val16, ok := float16.FromFloat64(val); ok {
 				val = val16.Float64()
 			}
@@ -136,7 +146,7 @@ func tryMeasure(ctx context.Context, opts MeasureOptions,
 			})
 		}
 
-		val := opts.Earliest.Query(0)
+		val := table.Query(0)
 		if val16, ok := float16.FromFloat64(val); ok {
 			val = val16.Float64()
 		}
@@ -214,7 +224,8 @@ func tryMeasure(ctx context.Context, opts MeasureOptions,
 		X:      opts.Padding + left.Width,
 		Y:      opts.Padding + obs.Height,
 
-		opts: opts,
+		opts:  opts,
+		table: table,
 	}, true
 }
 
@@ -230,10 +241,23 @@ type DrawOptions struct {
 
 	// Colors used for the heatmap.
 	Colors []draw.Color
+
+	// Compare, if not nil, is a set of columns to compare against. Instead
+	// of the Columns, the heatmap shows the difference between the CDF of
+	// each column and the compare column covering the same pixels, so
+	// Colors should diverge from the middle. The compare columns do not
+	// have to line up with the Columns. Pixels without both are not drawn.
+	Compare []draw.Column
+}
+
+// Size returns the size of the canvas the graph is drawn on, including the
+// padding.
+func (m Measured) Size() (w, h int) {
+	return m.opts.Width + 2*m.opts.Padding, m.opts.Height + 2*m.opts.Padding
 }
 
 func (m Measured) Draw(ctx context.Context, opts DrawOptions) *draw.RGB {
-	cw, ch := m.opts.Width+2*m.opts.Padding, m.opts.Height+2*m.opts.Padding
+	cw, ch := m.Size()
 	w, h := 0, 0
 	if opts.Canvas != nil {
 		w, h = opts.Canvas.Size()
@@ -257,6 +281,13 @@ func (m Measured) Draw(ctx context.Context, opts DrawOptions) *draw.RGB {
 	))
 
 	if m.opts.Earliest != nil {
+		cdf := m.table.CDF
+		if m.opts.ExactCDF {
+			if exact, ok := m.opts.Earliest.(dist.ExactCDFer); ok {
+				cdf = exact.ExactCDF
+			}
+		}
+
 		hm := heatmap.New(heatmap.Options{
 			Canvas: opts.Canvas.View(
 				m.opts.Padding+m.Left.Width,
@@ -265,10 +296,14 @@ func (m Measured) Draw(ctx context.Context, opts DrawOptions) *draw.RGB {
 				m.Height,
 			),
 			Colors: opts.Colors,
-			Map:    m.opts.Earliest.CDF,
+			Map:    cdf,
 		})
-		for _, col := range opts.Columns {
-			hm.Draw(ctx, col)
+		if opts.Compare == nil {
+			for _, col := range opts.Columns {
+				hm.Draw(ctx, col)
+			}
+		} else {
+			drawDifferences(ctx, hm, opts.Columns, opts.Compare)
 		}
 
 		key.Draw(opts.Canvas.View(
@@ -301,3 +336,38 @@ func (m Measured) Draw(ctx context.Context, opts DrawOptions) *draw.RGB {
 
 	return opts.Canvas
 }
+
+// drawDifferences draws the difference between every pixel of the columns
+// and the compare column that covers it.
+func drawDifferences(ctx context.Context, hm *heatmap.Heatmap,
+	cols, bases []draw.Column) {
+
+	bases = append([]draw.Column(nil), bases...)
+	sort.Slice(bases, func(i, j int) bool { return bases[i].X < bases[j].X })
+
+	for _, col := range cols {
+		// find the first base that ends after the column starts
+		i := sort.Search(len(bases), func(i int) bool {
+			return bases[i].X+bases[i].W > col.X
+		})
+
+		for _, base := range bases[i:] {
+			if base.X >= col.X+col.W {
+				break
+			}
+
+			// draw only the pixels of the column that the base covers
+			low, high := col.X, col.X+col.W
+			if base.X > low {
+				low = base.X
+			}
+			if base.X+base.W < high {
+				high = base.X + base.W
+			}
+
+			part := col
+			part.X, part.W = low, high-low
+			hm.DrawDifference(ctx, part, base)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Copyright (C) 2018. See AUTHORS.
+
+// package grid provides a way to draw a grid of graphs as small multiples
+package grid
@@ -0,0 +1,92 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package grid
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/zeebo/rothko/draw"
+	"github.com/zeebo/rothko/draw/graph"
+	"github.com/zeebo/rothko/draw/iosevka"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	titlePadding = 2 // px
+)
+
+// Panel is a single graph in the grid.
+type Panel struct {
+	// Title is drawn above the graph.
+	Title string
+
+	// Columns is the set of columns to draw on the graph.
+	Columns []draw.Column
+}
+
+// Options are all the ways you can configure the grid.
+type Options struct {
+	// Measured is the measured graph every panel is drawn with, so that they
+	// all share the same axes.
+	Measured graph.Measured
+
+	// Panels are the graphs to draw, from left to right and then top to
+	// bottom.
+	Panels []Panel
+
+	// Columns is how many panels are in each row. If zero, the grid is made
+	// as close to square as possible.
+	Columns int
+
+	// Colors used for the heatmaps.
+	Colors []draw.Color
+}
+
+// Draw renders all of the panels into a newly allocated canvas.
+func Draw(ctx context.Context, opts Options) *draw.RGB {
+	columns := opts.Columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(opts.Panels)))))
+	}
+	if columns > len(opts.Panels) {
+		columns = len(opts.Panels)
+	}
+	if columns <= 0 {
+		columns = 1
+	}
+	rows := (len(opts.Panels) + columns - 1) / columns
+
+	width, height := opts.Measured.Size()
+	bounds, _ := font.BoundString(iosevka.Iosevka, "Mg")
+	title_height := (bounds.Max.Y - bounds.Min.Y).Ceil() + 2*titlePadding
+	cell_height := title_height + height
+
+	canvas := draw.NewRGB(columns*width, rows*cell_height)
+
+	for i, panel := range opts.Panels {
+		x := (i % columns) * width
+		y := (i / columns) * cell_height
+
+		title := canvas.View(x, y, width, title_height)
+		(&font.Drawer{
+			Dst:  title.AsImage(),
+			Src:  image.Black,
+			Face: iosevka.Iosevka,
+			Dot: fixed.Point26_6{
+				X: fixed.I(opts.Measured.X),
+				Y: fixed.I(titlePadding) - bounds.Min.Y,
+			},
+		}).DrawString(panel.Title)
+
+		opts.Measured.Draw(ctx, graph.DrawOptions{
+			Canvas:  canvas.View(x, y+title_height, width, height),
+			Columns: panel.Columns,
+			Colors:  opts.Colors,
+		})
+	}
+
+	return canvas
+}
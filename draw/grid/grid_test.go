@@ -0,0 +1,54 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/draw/colors"
+	"github.com/zeebo/rothko/draw/graph"
+)
+
+var ctx = context.Background()
+
+func TestDraw(t *testing.T) {
+	measured, ok := graph.Measure(ctx, graph.MeasureOptions{
+		Now:      time.Now().UnixNano(),
+		Duration: time.Hour,
+		Width:    300,
+		Height:   150,
+		Padding:  5,
+	})
+	assert.That(t, ok)
+	width, height := measured.Size()
+
+	draw := func(panels, columns int) (w, h int) {
+		out := Draw(ctx, Options{
+			Measured: measured,
+			Panels:   make([]Panel, panels),
+			Columns:  columns,
+			Colors:   colors.Viridis,
+		})
+		return out.Size()
+	}
+
+	t.Run("Square", func(t *testing.T) {
+		w, h := draw(5, 0)
+		assert.Equal(t, w, 3*width)
+		assert.That(t, h > 2*height && h < 3*height)
+	})
+
+	t.Run("Columns", func(t *testing.T) {
+		w, h := draw(5, 5)
+		assert.Equal(t, w, 5*width)
+		assert.That(t, h > height && h < 2*height)
+	})
+
+	t.Run("FewPanels", func(t *testing.T) {
+		w, _ := draw(2, 4)
+		assert.Equal(t, w, 2*width)
+	})
+}
@@ -30,6 +30,7 @@ type Heatmap struct {
 	m             *draw.RGB // possibly type asserted
 	color_scale   float64
 	width, height int
+	diffs         []float64
 }
 
 // New returns a new Heatmap using the given options.
@@ -49,20 +50,96 @@ func New(opts Options) *Heatmap {
 
 // Draw writes the column to the canvas.
 func (d *Heatmap) Draw(ctx context.Context, col draw.Column) {
+	d.draw(ctx, col, d.opts.Map)
+}
+
+// DrawDifference writes the difference between the column and the base
+// column to the canvas. Each row is colored by how much larger the mapped
+// value of the column is than the mapped value of the base at the same
+// quantile, from the first color at -1 to the last color at 1, so the colors
+// should diverge from the middle. Only the position of the column is used,
+// so the base column may be at any position.
+func (d *Heatmap) DrawDifference(ctx context.Context, col, base draw.Column) {
+	if cap(d.diffs) < d.height {
+		d.diffs = make([]float64, d.height)
+	}
+	d.diffs = d.diffs[:d.height]
+
+	for y := range d.diffs {
+		q := d.quantile(y)
+		diff := d.opts.Map(valueAt(col, q)) - d.opts.Map(valueAt(base, q))
+		d.diffs[y] = (diff + 1) / 2
+	}
+
+	// draw a column with a value for every row that is already mapped
+	d.draw(ctx, draw.Column{
+		X:    col.X,
+		W:    col.W,
+		Data: d.diffs,
+	}, identity)
+}
+
+// quantile returns the quantile of the row y. a canvas that is a single row
+// high only draws the smallest quantile.
+func (d *Heatmap) quantile(y int) float64 {
+	if d.height <= 1 {
+		return 0
+	}
+	return float64(y) / float64(d.height-1)
+}
+
+// identity is a Map that does nothing.
+func identity(x float64) float64 { return x }
+
+// valueAt returns the value of the column at the quantile q, using the same
+// rules as drawing a row at that quantile.
+func valueAt(col draw.Column, q float64) float64 {
+	if len(col.Quantiles) != len(col.Data) {
+		return col.Data[int(q*float64(len(col.Data)-1))]
+	}
+	index := 0
+	for index+1 < len(col.Quantiles) && col.Quantiles[index+1] <= q {
+		index++
+	}
+	return col.Data[index]
+}
+
+// draw writes the column to the canvas using the mapping to pick colors.
+func (d *Heatmap) draw(ctx context.Context, col draw.Column,
+	mapping func(float64) float64) {
+
 	last_index := -1
 	last_color := d.opts.Colors[0]
-	index_scale := float64(len(col.Data)-1) / float64(d.height-1)
+	index_scale := 0.0
+	if d.height > 1 {
+		index_scale = float64(len(col.Data)-1) / float64(d.height-1)
+	}
 	m := d.m
 
+	// if the column has explicit quantiles, use the index of the largest
+	// quantile at or below the quantile of each row.
+	quantiles := col.Quantiles
+	if len(quantiles) != len(col.Data) {
+		quantiles = nil
+	}
+	index := 0
+
 	for y := 0; y < d.height; y++ {
-		// TODO(jeff): truncating might not work. we can also perhaps
-		// invert this computation to give us the number of pixels
-		// before we get to the next index directly.
-		index := int(float64(y) * index_scale)
+		if quantiles == nil {
+			// TODO(jeff): truncating might not work. we can also perhaps
+			// invert this computation to give us the number of pixels
+			// before we get to the next index directly.
+			index = int(float64(y) * index_scale)
+		} else {
+			q := d.quantile(y)
+			for index+1 < len(quantiles) && quantiles[index+1] <= q {
+				index++
+			}
+		}
 
 		// figure out the color if it's different from the last data index
 		if index != last_index {
-			color_index := int(d.opts.Map(col.Data[index]) * d.color_scale)
+			color_index := int(mapping(col.Data[index]) * d.color_scale)
 			last_color = d.opts.Colors[color_index]
 			last_index = index
 		}
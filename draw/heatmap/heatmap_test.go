@@ -5,6 +5,7 @@ package heatmap
 import (
 	"testing"
 
+	"github.com/zeebo/assert"
 	"github.com/zeebo/rothko/draw"
 )
 
@@ -26,6 +27,88 @@ func TestContext(t *testing.T) {
 	})
 }
 
+func TestQuantiles(t *testing.T) {
+	col := draw.Column{
+		X:         0,
+		W:         1,
+		Data:      []float64{0, 1, 2, 3},
+		Quantiles: []float64{0, 0.5, 0.99, 1},
+	}
+
+	m := draw.NewRGB(1, 101)
+	d := New(Options{
+		Colors: grayscale,
+		Canvas: m,
+		Map:    func(x float64) float64 { return x / 3 },
+	})
+	d.Draw(ctx, col)
+
+	// rows are drawn bottom up, and row y is at quantile y / 100.
+	value := func(y int) uint8 { return m.Raw(0, 100-y)[0] }
+	assert.Equal(t, value(0), uint8(0))
+	assert.Equal(t, value(49), uint8(0))
+	assert.Equal(t, value(50), uint8(85))
+	assert.Equal(t, value(98), uint8(85))
+	assert.Equal(t, value(99), uint8(170))
+	assert.Equal(t, value(100), uint8(255))
+}
+
+func TestDrawDifference(t *testing.T) {
+	col := draw.Column{X: 0, W: 1, Data: []float64{0, 1, 1}}
+	base := draw.Column{
+		X:         0,
+		W:         1,
+		Data:      []float64{0, 0.5, 1},
+		Quantiles: []float64{0, 0.25, 1},
+	}
+
+	m := draw.NewRGB(1, 101)
+	d := New(Options{
+		Colors: grayscale,
+		Canvas: m,
+		Map:    func(x float64) float64 { return x },
+	})
+	d.DrawDifference(ctx, col, base)
+
+	// rows are drawn bottom up, and row y is at quantile y / 100. no
+	// difference is in the middle of the colors.
+	value := func(y int) uint8 { return m.Raw(0, 100-y)[0] }
+	assert.Equal(t, value(0), uint8(127))
+	assert.Equal(t, value(24), uint8(127))
+	assert.Equal(t, value(25), uint8(63))
+	assert.Equal(t, value(49), uint8(63))
+	assert.Equal(t, value(50), uint8(191))
+	assert.Equal(t, value(99), uint8(191))
+	assert.Equal(t, value(100), uint8(127))
+}
+
+func TestSingleRow(t *testing.T) {
+	col := draw.Column{X: 0, W: 1, Data: []float64{0.5, 1}}
+	base := draw.Column{
+		X:         0,
+		W:         1,
+		Data:      []float64{0, 1},
+		Quantiles: []float64{0, 1},
+	}
+
+	m := draw.NewRGB(1, 1)
+	d := New(Options{
+		Colors: grayscale,
+		Canvas: m,
+		Map:    func(x float64) float64 { return x },
+	})
+
+	// the only row is at the smallest quantile.
+	d.Draw(ctx, col)
+	assert.Equal(t, m.Raw(0, 0)[0], uint8(127))
+
+	d.Draw(ctx, base)
+	assert.Equal(t, m.Raw(0, 0)[0], uint8(0))
+
+	d.DrawDifference(ctx, col, base)
+	assert.Equal(t, m.Raw(0, 0)[0], uint8(191))
+}
+
 func BenchmarkContext(b *testing.B) {
 	cols, linear := testMakeColumns(100, 30, 10, func(x, y int) float64 {
 		return float64(x + y)
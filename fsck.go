@@ -0,0 +1,109 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package rothko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/zeebo/rothko/config"
+	"github.com/zeebo/rothko/database/files"
+	"github.com/zeebo/rothko/registry"
+	"github.com/zeebo/errs"
+)
+
+var fsckCommand = cli.Command{
+	Name:  "fsck",
+	Usage: "check the files database for problems",
+	ArgsUsage: t(`
+<path to rothko config>
+
+To generate a rothko config, see the init command.
+`),
+
+	Description: t(`
+The fsck command checks every file in the files database for unreadable
+metadata or records, incomplete multi part records, records that are out of
+order, and missing data files. It should not be run while rothko is running.
+
+With --repair, files with problems are rewritten to keep only the records
+that are intact and in order, and missing data files are closed up. With
+--dump, the files and records for the metric are printed instead.
+`),
+
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "repair",
+			Usage: "rewrite files with problems",
+		},
+		cli.StringFlag{
+			Name:  "dump",
+			Usage: "print the files and records for the `metric`",
+		},
+	},
+
+	Action: func(c *cli.Context) error {
+		if err := checkArgs(c, 1); err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(c.Args().Get(0))
+		if err != nil {
+			return errs.Wrap(err)
+		}
+
+		conf, err := config.Load(data)
+		if err != nil {
+			return err
+		}
+
+		return fsck(context.Background(), conf,
+			c.Bool("repair"), c.String("dump"))
+	},
+}
+
+// fsck checks the files database defined by the config, repairing it if
+// requested, or dumps the metric if it is not empty.
+func fsck(ctx context.Context, conf *config.Config, repair bool,
+	metric string) (err error) {
+
+	db, err := registry.NewDatabase(ctx,
+		conf.Database.Kind, conf.Database.Config)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	fdb, ok := db.(*files.DB)
+	if !ok {
+		fmt.Printf("fsck only supports the files database, not %q\n",
+			conf.Database.Kind)
+		return handled.New("")
+	}
+
+	if metric != "" {
+		return fdb.Dump(ctx, metric, os.Stdout)
+	}
+
+	problems, err := fdb.Check(ctx, repair)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if err != nil {
+		return err
+	}
+
+	repaired := 0
+	for _, problem := range problems {
+		if problem.Repaired {
+			repaired++
+		}
+	}
+	fmt.Printf("found %d problem(s), repaired %d\n", len(problems), repaired)
+
+	if repaired < len(problems) {
+		return handled.New("")
+	}
+	return nil
+}
@@ -4,6 +4,9 @@ package typeassert
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/zeebo/errs"
 )
@@ -77,18 +80,44 @@ func (a *Asserter) N(index int) *Asserter {
 		return a.a(nil, path)
 	}
 
-	m, ok := a.x.([]interface{})
-	if !ok {
-		*a.err = errs.New("invalid type: map[string]interface{} != %T at %s",
+	switch m := a.x.(type) {
+	case []interface{}:
+		if index >= len(m) {
+			*a.err = errs.New("array out of bounds")
+			return a
+		}
+		return a.a(m[index], path)
+
+	case []map[string]interface{}:
+		if index >= len(m) {
+			*a.err = errs.New("array out of bounds")
+			return a
+		}
+		return a.a(m[index], path)
+
+	default:
+		*a.err = errs.New("invalid type: []interface{} != %T at %s",
 			a.x, a.path)
 		return a
 	}
-	if index >= len(m) {
-		*a.err = errs.New("array out of bounds")
-		return a
-	}
+}
 
-	return a.a(m[index], path)
+// Len asserts the value as a []interface{} or a []map[string]interface{},
+// and returns its length.
+func (a *Asserter) Len() int {
+	if *a.err != nil || a.x == nil {
+		return 0
+	}
+	switch m := a.x.(type) {
+	case []interface{}:
+		return len(m)
+	case []map[string]interface{}:
+		return len(m)
+	default:
+		*a.err = errs.New("invalid type: []interface{} != %T at %s",
+			a.x, a.path)
+		return 0
+	}
 }
 
 // Int asserts the value as an int.
@@ -150,3 +179,29 @@ func (a *Asserter) Float64() float64 {
 	}
 	return m
 }
+
+// Duration asserts the value as a string holding a duration. In addition to
+// the units accepted by time.ParseDuration, a whole number of days can be
+// specified with a "d" suffix, like "90d".
+func (a *Asserter) Duration() time.Duration {
+	s := a.String()
+	if *a.err != nil || s == "" {
+		return 0
+	}
+
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			*a.err = errs.New("invalid duration: %q at %s", s, a.path)
+			return 0
+		}
+		return time.Duration(n) * 24 * time.Hour
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		*a.err = errs.New("invalid duration: %q at %s", s, a.path)
+		return 0
+	}
+	return d
+}
@@ -4,6 +4,7 @@ package typeassert
 
 import (
 	"testing"
+	"time"
 
 	"github.com/zeebo/assert"
 )
@@ -20,6 +21,9 @@ func TestAsserter(t *testing.T) {
 		"string": "foo",
 		"list":   L{2, true, "foo"},
 		"map":    D{"int": 2},
+		"tables": []D{{"int": 2}},
+		"dur":    "90m",
+		"days":   "90d",
 	}
 
 	t.Run("Success", func(t *testing.T) {
@@ -31,6 +35,13 @@ func TestAsserter(t *testing.T) {
 		assert.Equal(t, a.I("list").N(1).Bool(), true)
 		assert.Equal(t, a.I("list").N(2).String(), "foo")
 		assert.Equal(t, a.I("map").I("int").Int(), 2)
+		assert.Equal(t, a.I("list").Len(), 3)
+		assert.Equal(t, a.I("tables").Len(), 1)
+		assert.Equal(t, a.I("tables").N(0).I("int").Int(), 2)
+		assert.Equal(t, a.I("dur").Duration(), 90*time.Minute)
+		assert.Equal(t, a.I("days").Duration(), 90*24*time.Hour)
+		assert.Equal(t, a.I("missing").Len(), 0)
+		assert.Equal(t, a.I("missing").Duration(), time.Duration(0))
 		assert.NoError(t, a.Err())
 	})
 
@@ -65,5 +76,17 @@ func TestAsserter(t *testing.T) {
 			assert.Error(t, a.Err())
 		}
 
+		{
+			a := A(data)
+			a.I("map").Len()
+			assert.Error(t, a.Err())
+		}
+
+		{
+			a := A(data)
+			a.I("string").Duration()
+			assert.Error(t, a.Err())
+		}
+
 	})
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/zeebo/errs"
 
 	_ "github.com/zeebo/rothko/database/files"
+	_ "github.com/zeebo/rothko/dist/loglinear"
+	_ "github.com/zeebo/rothko/dist/moments"
 	_ "github.com/zeebo/rothko/dist/tdigest"
 	_ "github.com/zeebo/rothko/listener/graphite"
 	_ "github.com/zeebo/rothko/listener/storj"
@@ -28,6 +30,8 @@ func Main() {
 		initCommand,
 		runCommand,
 		demoCommand,
+		fsckCommand,
+		migrateCommand,
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,87 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"context"
+	"math"
+
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/errs"
+)
+
+//
+// exponential decay merging blends every column with the columns before it.
+// walking from the oldest column to the newest, we keep a running blended
+// distribution. before a column is added to it, its weight is scaled by how
+// many half lives have passed since the previous column, which is done by
+// resampling it with the smaller number of observations.
+//
+
+// decay blends all of the merged columns and appends them to the columns.
+func (m *Merger) decay(ctx context.Context, results []mergeResult) error {
+	var (
+		acc        dist.Dist
+		acc_weight float64
+		acc_obs    float64
+		acc_center float64
+	)
+
+	// columns were emitted newest first, so walk them backwards and fill in
+	// the columns in the same order.
+	columns := make([]mergeResult, len(results))
+	for i := len(results) - 1; i >= 0; i-- {
+		col := results[i]
+		center := float64(col.start+col.end) / 2
+
+		next, err := m.opts.Params.New()
+		if err != nil {
+			return errs.Wrap(err)
+		}
+
+		// scale the previous blend by the time elapsed between the centers
+		// of the columns.
+		factor := 0.0
+		if acc != nil {
+			elapsed := (center - acc_center) * float64(m.pixel_size)
+			factor = math.Exp2(-elapsed / float64(m.opts.HalfLife))
+		}
+		if count := int64(acc_weight*factor + 0.5); count > 0 {
+			if err := load.Resample(ctx, next, acc, count); err != nil {
+				return errs.Wrap(err)
+			}
+		}
+		if err := mergeDist(ctx, next, col.dist); err != nil {
+			return err
+		}
+
+		weight := float64(col.dist.Len())
+		if total := acc_weight*factor + weight; total > 0 {
+			acc_obs = (acc_obs*acc_weight*factor + col.obs_sec*weight) / total
+		}
+
+		acc, acc_weight, acc_center = next, acc_weight*factor+weight, center
+		columns[i] = mergeResult{
+			start:   col.start,
+			end:     col.end,
+			dist:    acc,
+			obs_sec: acc_obs,
+		}
+	}
+
+	for _, col := range columns {
+		m.columns = append(m.columns,
+			m.column(col.start, col.end, col.dist, col.obs_sec))
+	}
+	return nil
+}
+
+// mergeDist adds all of the observations in the distribution into out,
+// merging them directly if possible.
+func mergeDist(ctx context.Context, out, in dist.Dist) error {
+	if merger, ok := out.(dist.Merger); ok && in.Kind() == out.Kind() {
+		return errs.Wrap(merger.Merge(in))
+	}
+	return errs.Wrap(load.Resample(ctx, out, in, in.Len()))
+}
@@ -6,7 +6,8 @@ import (
 	"context"
 
 	"github.com/zeebo/rothko/data"
-	"github.com/zeebo/rothko/dist/tdigest"
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/dist"
 )
 
 // TODO(jeff): don't merge into tdigest, merge into a flat weighted buffer
@@ -15,11 +16,20 @@ import (
 // MergeOptions are the arguments passed to Merge.
 type MergeOptions struct {
 	// Params are the parameters for the output distribution the merged record
-	// should have.
-	Params tdigest.Params
+	// should have. Records of a different kind are converted by resampling.
+	// If nil, the output has the kind of the first record with the largest
+	// weight, and the other records are merged into its distribution.
+	Params dist.Params
 
 	// Records are the set of records to merge.
 	Records []data.Record
+
+	// Weights, if set, are the fraction of each record to include, in
+	// (0, 1]. Only the relative weights change the shape of the merged
+	// distribution, so the records with the largest weight are merged
+	// directly and the others are resampled with proportionally fewer
+	// observations.
+	Weights []float64
 }
 
 // Merge combines the records into one large record. The seed is used to do
@@ -30,6 +40,26 @@ func Merge(ctx context.Context, opts MergeOptions) (
 	if len(opts.Records) == 0 {
 		return out, Error.New("passed no records")
 	}
+	if opts.Weights != nil && len(opts.Weights) != len(opts.Records) {
+		return out, Error.New("passed %d weights for %d records",
+			len(opts.Weights), len(opts.Records))
+	}
+	weight := func(i int) float64 {
+		if opts.Weights == nil {
+			return 1
+		}
+		return opts.Weights[i]
+	}
+	max_weight := 0.0
+	for i := range opts.Records {
+		w := weight(i)
+		if w <= 0 || w > 1 {
+			return out, Error.New("invalid weight: %v", w)
+		}
+		if w > max_weight {
+			max_weight = w
+		}
+	}
 
 	// merge the start and end time
 	out.StartTime = opts.Records[0].StartTime
@@ -44,22 +74,33 @@ func Merge(ctx context.Context, opts MergeOptions) (
 	}
 
 	// merge the observations
-	for _, r := range opts.Records {
-		out.Observations += r.Observations
+	for i, r := range opts.Records {
+		out.Observations += scaleObservations(r.Observations, weight(i))
 	}
 
-	// merge the distributions
-	dist, err := opts.Params.New()
+	// merge the distributions. without params, start from the distribution
+	// of the first record with the largest weight.
+	var dist dist.Dist
+	base := -1
+	if opts.Params != nil {
+		dist, err = opts.Params.New()
+	} else {
+		for base = range opts.Records {
+			if weight(base) == max_weight {
+				break
+			}
+		}
+		dist, err = load.Load(ctx, opts.Records[base])
+	}
 	if err != nil {
 		return out, err
 	}
-	unwrapped, ok := dist.(*tdigest.Wrapper)
-	if !ok {
-		return out, Error.New("programmer error: params did not make t-digest")
-	}
-	res := newResampler(unwrapped.Underlying())
-	for _, r := range opts.Records {
-		err := res.Sample(ctx, r)
+	res := newResampler(dist)
+	for i, r := range opts.Records {
+		if i == base {
+			continue
+		}
+		err := res.Sample(ctx, r, weight(i)/max_weight)
 		if err != nil {
 			return out, err
 		}
@@ -94,3 +135,12 @@ func Merge(ctx context.Context, opts MergeOptions) (
 
 	return out, nil
 }
+
+// scaleObservations returns the number of observations in the fraction of a
+// record, rounded to the nearest integer.
+func scaleObservations(observations int64, fraction float64) int64 {
+	if fraction >= 1 {
+		return observations
+	}
+	return int64(float64(observations)*fraction + 0.5)
+}
@@ -5,18 +5,14 @@ package merge
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/zeebo/rothko/data"
-	"github.com/zeebo/rothko/data/load"
-	"github.com/zeebo/rothko/dist/tdigest"
+	"github.com/zeebo/rothko/dist"
 	"github.com/zeebo/rothko/draw"
-	"github.com/zeebo/errs"
-	"github.com/zeebo/float16"
 )
 
-// TODO(jeff): a slice is absolutely the wrong data structure
-
 const debug = false
 
 func debugPrint(vals ...interface{}) {
@@ -28,6 +24,7 @@ func debugPrint(vals ...interface{}) {
 type mergeRecord struct {
 	rec        data.Record
 	start, end int64
+	pushed     int
 }
 
 // MergerOptions are the options the Merger needs to operate.
@@ -35,20 +32,48 @@ type MergerOptions struct {
 	Samples  int
 	Now      int64
 	Duration time.Duration
-	Params   tdigest.Params
+	Params   dist.Params
+
+	// HalfLife enables exponential decay merging if positive. Every column
+	// then blends in the columns before it, with their weight halving every
+	// HalfLife. This smooths out per-interval noise to show trends.
+	HalfLife time.Duration
+
+	// Quantiles, if set, are the quantiles every column is sampled at instead
+	// of Samples + 1 evenly spaced quantiles. They must be increasing and in
+	// [0, 1]. See UniformQuantiles, TailQuantiles and CheckQuantiles.
+	Quantiles []float64
+
+	// Precision controls how the sampled values are rounded. The zero value
+	// rounds them to 16 bit floats.
+	Precision Precision
+
+	// Workers is how many columns are merged concurrently while records are
+	// pushed. If zero, GOMAXPROCS is used.
+	Workers int
 }
 
 // Merger allows iterative pushing of records in and constructs a series of
 // merged columns. The only requirement is that the end time on the records
 // passed to push are decreasing.
+//
+// It sweeps from the newest pixel to the oldest, keeping the set of active
+// records that overlap the pixel being swept, ordered by their start pixel.
+// Because end times are decreasing, records only join the set when they are
+// pushed, and leave it from the front once the sweep passes their start. Between those events the set does not
+// change, so the sweep jumps over every pixel until the next event and emits
+// them as a single column.
 type Merger struct {
 	opts       MergerOptions
 	pixel_size int64
 	width      int
 
 	completed_px int64
-	records      []mergeRecord
+	pushed       int
+	active       []mergeRecord
 	columns      []draw.Column
+	pool         pool
+	converted    bool
 }
 
 // NewMerger constructs a Merger with the options.
@@ -76,6 +101,44 @@ func (m *Merger) timeToPixel(time int64) int64 {
 	return px
 }
 
+// pixelToTime returns the earliest time that maps to the pixel. It is the
+// inverse of timeToPixel, so the pixel covers up to pixelToTime(px + 1).
+func (m *Merger) pixelToTime(px int64) int64 {
+	return m.opts.Now - (int64(m.width)-px)*m.pixel_size
+}
+
+// Overlap returns the fraction of the record that is in the time range
+// [start, end). Records without a duration are entirely included if they
+// start in the range.
+func Overlap(rec data.Record, start, end int64) float64 {
+	_, fraction := overlapOf(rec, start, end)
+	return fraction
+}
+
+// overlapOf returns how long the record overlaps the time range [start,
+// end), and what fraction of the record that is. Records without a duration
+// are entirely included if they start in the range.
+func overlapOf(rec data.Record, start, end int64) (int64, float64) {
+	if rec.EndTime <= rec.StartTime {
+		if start <= rec.StartTime && rec.StartTime < end {
+			return 0, 1
+		}
+		return 0, 0
+	}
+
+	lo, hi := rec.StartTime, rec.EndTime
+	if start > lo {
+		lo = start
+	}
+	if end < hi {
+		hi = end
+	}
+	if hi <= lo {
+		return 0, 0
+	}
+	return hi - lo, float64(hi-lo) / float64(rec.EndTime-rec.StartTime)
+}
+
 // Push adds the record to the Merger. The end time on the records passed to
 // Push must be decreasing.
 func (m *Merger) Push(ctx context.Context, rec data.Record) error {
@@ -84,23 +147,55 @@ func (m *Merger) Push(ctx context.Context, rec data.Record) error {
 	}
 
 	mrec := mergeRecord{
-		rec:   rec,
-		start: m.timeToPixel(rec.StartTime),
-		end:   m.timeToPixel(rec.EndTime),
+		rec:    rec,
+		start:  m.timeToPixel(rec.StartTime),
+		end:    m.timeToPixel(rec.EndTime),
+		pushed: m.pushed,
 	}
+	m.pushed++
 	debugPrint("adding", mrec.start, mrec.end)
 	if err := m.completed(ctx, mrec.end+1); err != nil {
 		return err
 	}
-	m.records = append(m.records, mrec)
+
+	// keep the active records ordered by their start, latest first, so that
+	// the ones the sweep passes first are at the front.
+	i := sort.Search(len(m.active), func(i int) bool {
+		return m.active[i].start < mrec.start
+	})
+	m.active = append(m.active, mergeRecord{})
+	copy(m.active[i+1:], m.active[i:])
+	m.active[i] = mrec
 	return nil
 }
 
+// Converted returns true if any of the records pushed so far had to be
+// converted from a different distribution kind than the Params.
+func (m *Merger) Converted() bool {
+	return m.converted
+}
+
 // Finish returns the set of columns to draw.
 func (m *Merger) Finish(ctx context.Context) ([]draw.Column, error) {
-	if err := m.completed(ctx, 0); err != nil {
+	err := m.completed(ctx, 0)
+	results, wait_err := m.wait(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if wait_err != nil {
+		return nil, wait_err
+	}
+
+	if m.opts.HalfLife > 0 {
+		if err := m.decay(ctx, results); err != nil {
+			return nil, err
+		}
+		return m.columns, nil
+	}
+
+	for _, res := range results {
+		m.columns = append(m.columns, res.col)
+	}
 	return m.columns, nil
 }
 
@@ -110,80 +205,32 @@ func (m *Merger) Finish(ctx context.Context) ([]draw.Column, error) {
 func (m *Merger) completed(ctx context.Context, completed_px int64) error {
 	debugPrint("completed", completed_px)
 
-	// some variables for our state
-	var (
-		to_emit_end_px int64
-		to_emit        []int
-		cand_emit      []int
-		emit_recs      []mergeRecord
-	)
-
-	for px := m.completed_px - 1; px >= completed_px; px-- {
-		// create a slice of records to emit
-		cand_emit = cand_emit[:0]
-		for i, mrec := range m.records {
-			if mrec.start <= px && px <= mrec.end {
-				cand_emit = append(cand_emit, i)
-			}
-		}
+	if completed_px >= m.completed_px {
+		return nil
+	}
 
-		// if the candidate is the same as to_emit, then don't worry about it.
-		if intsEq(cand_emit, to_emit) {
-			continue
+	for px := m.completed_px - 1; px >= completed_px; {
+		// remove the records the sweep has passed from the front.
+		for len(m.active) > 0 && m.active[0].start > px {
+			debugPrint("removing", m.active[0].start, m.active[0].end)
+			m.active = m.active[1:]
 		}
 
-		// if we have something to emit, do it.
-		if len(to_emit) > 0 {
-			emit_recs = emit_recs[:0]
-			for _, v := range to_emit {
-				emit_recs = append(emit_recs, m.records[v])
-			}
-			err := m.emit(ctx, px+1, to_emit_end_px, emit_recs)
-			if err != nil {
-				return err
-			}
+		// if nothing is active, nothing changes until the next push.
+		if len(m.active) == 0 {
+			break
 		}
 
-		// store the candidate as the next to emit
-		to_emit_end_px = px
-		to_emit = append(to_emit[:0], cand_emit...)
-	}
-
-	// if there's something left to emit, do it.
-	if len(to_emit) > 0 {
-		emit_recs = emit_recs[:0]
-		for _, v := range to_emit {
-			emit_recs = append(emit_recs, m.records[v])
+		// the set is unchanged down to the start of the first record, so
+		// emit up to it.
+		low_px := m.active[0].start
+		if low_px < completed_px {
+			low_px = completed_px
 		}
-		err := m.emit(ctx, completed_px, to_emit_end_px, emit_recs)
-		if err != nil {
+		if err := m.emit(ctx, low_px, px, m.active); err != nil {
 			return err
 		}
-	}
-
-	// prune off any prefix records welonger need. first, gather up the indexes
-	// of the records we want to remove.
-	var to_remove []int
-	for i := range m.records {
-		if m.records[i].start > completed_px &&
-			m.records[i].end > completed_px {
-
-			to_remove = append(to_remove, i)
-		}
-	}
-
-	// second, filter them out when iterating over the current set of records.
-	// since we added them to to_remove in sorted order, we can just iterate
-	// over the slice of to_remove.
-	current := m.records
-	m.records = m.records[:0]
-	for i, mrec := range current {
-		if len(to_remove) > 0 && to_remove[0] == i {
-			debugPrint("removing", mrec.start, mrec.end)
-			to_remove = to_remove[1:]
-			continue
-		}
-		m.records = append(m.records, mrec)
+		px = low_px - 1
 	}
 
 	// yay we've completed up to the pixel now.
@@ -192,60 +239,91 @@ func (m *Merger) completed(ctx context.Context, completed_px int64) error {
 }
 
 // emit constructs a column out of the records for the start and end pixels.
+// The records are merged into the column by the pool of workers.
 func (m *Merger) emit(ctx context.Context, start, end int64,
 	mrecs []mergeRecord) error {
 
 	debugPrint("emit", start, end)
 
-	obs_sec := 0.0
+	// weight every record by how much of it overlaps the time covered by
+	// the pixels, both in the distribution and in the observation rate.
+	// records that only touch the edge of the pixels are left out.
+	col_start, col_end := m.pixelToTime(start), m.pixelToTime(end+1)
+
+	// merge the records in the order they were pushed so that the column
+	// does not depend on how the active records are kept.
+	mrecs = append([]mergeRecord(nil), mrecs...)
+	sort.Slice(mrecs, func(i, j int) bool {
+		return mrecs[i].pushed < mrecs[j].pushed
+	})
+
+	obs_sec, overlaps := 0.0, 0.0
 	recs := make([]data.Record, 0, len(mrecs))
+	weights := make([]float64, 0, len(mrecs))
 	for _, mrec := range mrecs {
+		overlap, fraction := overlapOf(mrec.rec, col_start, col_end)
+		if fraction <= 0 {
+			continue
+		}
+
 		recs = append(recs, mrec.rec)
-		obs_sec += float64(mrec.rec.Observations) / float64(mrec.rec.Merged) /
-			time.Duration(mrec.rec.EndTime-mrec.rec.StartTime).Seconds()
-	}
-	obs_sec /= float64(len(mrecs))
+		weights = append(weights, fraction)
+		if mrec.rec.Kind != m.opts.Params.Kind() {
+			m.converted = true
+		}
 
-	out, err := Merge(ctx, MergeOptions{
-		Params:  m.opts.Params,
-		Records: recs,
-	})
-	if err != nil {
-		return errs.Wrap(err)
+		if overlap > 0 {
+			merged := mrec.rec.Merged
+			if merged == 0 {
+				merged = 1
+			}
+			rate := float64(mrec.rec.Observations) / float64(merged) /
+				time.Duration(mrec.rec.EndTime-mrec.rec.StartTime).Seconds()
+			obs_sec += rate * float64(overlap)
+			overlaps += float64(overlap)
+		}
 	}
-	dist, err := load.Load(ctx, out)
-	if err != nil {
-		return errs.Wrap(err)
+	if len(recs) == 0 {
+		return nil
 	}
+	if overlaps > 0 {
+		obs_sec /= overlaps
+	}
+
+	return m.submit(ctx, mergeJob{
+		start:   start,
+		end:     end,
+		recs:    recs,
+		weights: weights,
+		obs_sec: obs_sec,
+	})
+}
+
+// column samples the distribution into a column for the start and end
+// pixels.
+func (m *Merger) column(start, end int64, dist dist.Dist,
+	obs_sec float64) draw.Column {
+
 	col := draw.Column{
 		X:      int(start),
 		W:      int(end - start + 1),
-		Data:   make([]float64, 0, m.opts.Samples+1),
 		ObsSec: obs_sec,
 	}
-	f64_samples := float64(m.opts.Samples)
-	for i := float64(0); i <= f64_samples; i++ {
-		val := dist.Query(i / f64_samples)
-		val16, ok := float16.FromFloat64(val)
-		if ok {
-			val = val16.Float64()
-		}
-		col.Data = append(col.Data, val)
-	}
-
-	m.columns = append(m.columns, col)
-	return nil
-}
 
-// intsEq returns if the integers are equal.
-func intsEq(a, b []int) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
+	if m.opts.Quantiles != nil {
+		col.Data = make([]float64, 0, len(m.opts.Quantiles))
+		col.Quantiles = m.opts.Quantiles
+		for _, q := range m.opts.Quantiles {
+			col.Data = append(col.Data, dist.Query(q))
+		}
+	} else {
+		col.Data = make([]float64, 0, m.opts.Samples+1)
+		f64_samples := float64(m.opts.Samples)
+		for i := float64(0); i <= f64_samples; i++ {
+			col.Data = append(col.Data, dist.Query(i/f64_samples))
 		}
 	}
-	return true
+
+	m.opts.Precision.round(col.Data)
+	return col
 }
@@ -0,0 +1,336 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/dist/tdigest"
+	"github.com/zeebo/rothko/draw"
+)
+
+var ctx = context.Background()
+
+var testParams = tdigest.Params{Compression: 5}
+
+// newTestRecord returns a record for [start, end) with n observations of
+// val.
+func newTestRecord(t testing.TB, start, end time.Duration, val float64,
+	n int) data.Record {
+
+	d, err := testParams.New()
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		d.Observe(val)
+	}
+
+	return data.Record{
+		StartTime:    start.Nanoseconds(),
+		EndTime:      end.Nanoseconds(),
+		Observations: int64(n),
+		Distribution: d.Marshal(nil),
+		Kind:         d.Kind(),
+		Merged:       1,
+		Min:          val,
+		Max:          val,
+	}
+}
+
+// runMerger pushes the records, which must have decreasing end times, into a
+// Merger with the options and returns the columns.
+func runMerger(t testing.TB, opts MergerOptions, width int,
+	recs []data.Record) []draw.Column {
+
+	m := NewMerger(opts)
+	m.SetWidth(width)
+	for _, rec := range recs {
+		assert.NoError(t, m.Push(ctx, rec))
+	}
+	cols, err := m.Finish(ctx)
+	assert.NoError(t, err)
+	return cols
+}
+
+func TestMergerDecay(t *testing.T) {
+	// one record per second for 20 seconds, stepping from 0 to 100 halfway.
+	var recs []data.Record
+	for i := time.Duration(19); i >= 0; i-- {
+		val := 0.0
+		if i >= 10 {
+			val = 100
+		}
+		recs = append(recs,
+			newTestRecord(t, i*time.Second, (i+1)*time.Second, val, 100))
+	}
+
+	opts := MergerOptions{
+		Samples:  4,
+		Now:      20 * int64(time.Second),
+		Duration: 20 * time.Second,
+		Params:   testParams,
+	}
+	plain := runMerger(t, opts, 20, recs)
+
+	opts.HalfLife = time.Second
+	decayed := runMerger(t, opts, 20, recs)
+
+	assert.Equal(t, len(decayed), len(plain))
+
+	for i := range plain {
+		assert.Equal(t, decayed[i].X, plain[i].X)
+		assert.Equal(t, decayed[i].W, plain[i].W)
+		assert.Equal(t, decayed[i].ObsSec, plain[i].ObsSec)
+	}
+
+	// find the first column entirely after the step. without decay it only
+	// has the new value, but with decay the old values bleed into it.
+	found := false
+	for i, col := range plain {
+		if col.X != 10 {
+			continue
+		}
+		found = true
+		assert.Equal(t, col.Data[0], 100.0)
+		assert.Equal(t, decayed[i].Data[1], 0.0)
+		assert.Equal(t, decayed[i].Data[4], 100.0)
+	}
+	assert.That(t, found)
+
+	// far from the step, the old values have decayed away, and the new
+	// values never bleed into the past.
+	assert.Equal(t, decayed[0].Data[0], 100.0)
+	assert.Equal(t, decayed[len(decayed)-1].Data[4], 0.0)
+}
+
+func TestMergerOverlap(t *testing.T) {
+	// a wide record of 0 from [0s, 1.5s) next to a narrow record of 100 from
+	// [1.5s, 2s). the pixel covering [1s, 2s) only includes a third of the
+	// wide record.
+	recs := []data.Record{
+		newTestRecord(t, 1500*time.Millisecond, 2*time.Second, 100, 100),
+		newTestRecord(t, 0, 1500*time.Millisecond, 0, 100),
+	}
+
+	cols := runMerger(t, MergerOptions{
+		Samples:  4,
+		Now:      2 * int64(time.Second),
+		Duration: 2 * time.Second,
+		Params:   testParams,
+	}, 2, recs)
+
+	assert.Equal(t, len(cols), 2)
+
+	assert.Equal(t, cols[0].X, 1)
+	assert.Equal(t, cols[0].Data[0], 0.0)
+	assert.Equal(t, cols[0].Data[2], 100.0)
+	assert.That(t, math.Abs(cols[0].ObsSec-(100/1.5+200)/2) < 1e-9)
+
+	assert.Equal(t, cols[1].X, 0)
+	assert.Equal(t, cols[1].Data[4], 0.0)
+	assert.That(t, math.Abs(cols[1].ObsSec-100/1.5) < 1e-9)
+}
+
+func TestMergerNested(t *testing.T) {
+	// a record of 0 for [0s, 10s) pushed before shorter records of 100 for
+	// [8s, 9s) and 50 for [4s, 5s) that start after it. the columns end
+	// where the records start.
+	recs := []data.Record{
+		newTestRecord(t, 0, 10*time.Second, 0, 100),
+		newTestRecord(t, 8*time.Second, 9*time.Second, 100, 100),
+		newTestRecord(t, 4*time.Second, 5*time.Second, 50, 100),
+	}
+
+	cols := runMerger(t, MergerOptions{
+		Samples:  4,
+		Now:      10 * int64(time.Second),
+		Duration: 10 * time.Second,
+		Params:   testParams,
+	}, 10, recs)
+
+	type span struct{ X, W int }
+	expected := []struct {
+		span
+		max float64
+	}{
+		{span{8, 2}, 100},
+		{span{6, 2}, 0},
+		{span{4, 2}, 50},
+		{span{0, 4}, 0},
+	}
+
+	assert.Equal(t, len(cols), len(expected))
+	for i, col := range cols {
+		assert.Equal(t, span{col.X, col.W}, expected[i].span)
+		assert.Equal(t, col.Data[4], expected[i].max)
+	}
+}
+
+func TestOverlapOf(t *testing.T) {
+	rec := data.Record{StartTime: 10, EndTime: 20}
+
+	for _, test := range []struct {
+		start, end int64
+		overlap    int64
+		fraction   float64
+	}{
+		{0, 10, 0, 0},
+		{0, 15, 5, 0.5},
+		{12, 14, 2, 0.2},
+		{0, 30, 10, 1},
+		{20, 30, 0, 0},
+	} {
+		overlap, fraction := overlapOf(rec, test.start, test.end)
+		assert.Equal(t, overlap, test.overlap)
+		assert.Equal(t, fraction, test.fraction)
+	}
+
+	point := data.Record{StartTime: 10, EndTime: 10}
+	_, fraction := overlapOf(point, 10, 20)
+	assert.Equal(t, fraction, 1.0)
+	_, fraction = overlapOf(point, 0, 10)
+	assert.Equal(t, fraction, 0.0)
+}
+
+func TestMergeWithoutParams(t *testing.T) {
+	recs := []data.Record{
+		newTestRecord(t, 0, time.Second, 1, 10),
+		newTestRecord(t, time.Second, 2*time.Second, 2, 30),
+	}
+
+	out, err := Merge(ctx, MergeOptions{Records: recs})
+	assert.NoError(t, err)
+	assert.Equal(t, out.Kind, "tdigest")
+	assert.Equal(t, out.Observations, int64(40))
+	assert.Equal(t, out.Merged, int64(2))
+
+	d, err := load.Load(ctx, out)
+	assert.NoError(t, err)
+	assert.Equal(t, d.Len(), int64(40))
+	assert.Equal(t, d.Query(0), 1.0)
+	assert.Equal(t, d.Query(1), 2.0)
+}
+
+func TestMergerWorkers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	var recs []data.Record
+	for i := time.Duration(500); i > 0; i-- {
+		recs = append(recs, newTestRecord(t, (i-1)*time.Second,
+			i*time.Second, rng.NormFloat64()*10+50, 10))
+	}
+
+	opts := MergerOptions{
+		Samples:  10,
+		Now:      500 * int64(time.Second),
+		Duration: 500 * time.Second,
+		Params:   testParams,
+		Workers:  1,
+	}
+	serial := runMerger(t, opts, 100, recs)
+
+	opts.Workers = 8
+	parallel := runMerger(t, opts, 100, recs)
+
+	assert.Equal(t, len(serial), 100)
+	assert.DeepEqual(t, parallel, serial)
+}
+
+func TestMergerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	m := NewMerger(MergerOptions{
+		Samples:  10,
+		Now:      10 * int64(time.Second),
+		Duration: 10 * time.Second,
+		Params:   testParams,
+	})
+	m.SetWidth(10)
+
+	for i := time.Duration(10); i > 0; i-- {
+		// pushes may or may not notice the cancel, but finish must.
+		_ = m.Push(ctx, newTestRecord(t, (i-1)*time.Second, i*time.Second,
+			1, 1))
+	}
+	_, err := m.Finish(ctx)
+	assert.Error(t, err)
+}
+
+func TestMergerPushCanceled(t *testing.T) {
+	// callers push from query callbacks whose context is canceled when the
+	// query returns, so a canceled push context must not fail Finish.
+	push_ctx, cancel := context.WithCancel(ctx)
+
+	m := NewMerger(MergerOptions{
+		Samples:  10,
+		Now:      10 * int64(time.Second),
+		Duration: 10 * time.Second,
+		Params:   testParams,
+		Workers:  1,
+	})
+	m.SetWidth(10)
+
+	for i := time.Duration(10); i > 0; i-- {
+		assert.NoError(t, m.Push(push_ctx, newTestRecord(t,
+			(i-1)*time.Second, i*time.Second, 1, 1)))
+	}
+	cancel()
+
+	cols, err := m.Finish(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(cols), 10)
+}
+
+func BenchmarkMerger(b *testing.B) {
+	run := func(b *testing.B, window, interval time.Duration, width int) {
+		rng := rand.New(rand.NewSource(1))
+		records := int(window / interval)
+
+		recs := make([]data.Record, 0, records)
+		for i := records; i > 0; i-- {
+			end := time.Duration(i) * interval
+			recs = append(recs, newTestRecord(b, end-interval, end,
+				rng.NormFloat64()*10+50, 10))
+		}
+
+		opts := MergerOptions{
+			Samples:  30,
+			Now:      window.Nanoseconds(),
+			Duration: window,
+			Params:   testParams,
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			m := NewMerger(opts)
+			m.SetWidth(width)
+			for _, rec := range recs {
+				if err := m.Push(ctx, rec); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if _, err := m.Finish(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("1d-10m-1000px", func(b *testing.B) {
+		run(b, 24*time.Hour, 10*time.Minute, 1000)
+	})
+	b.Run("1d-1m-1000px", func(b *testing.B) {
+		run(b, 24*time.Hour, time.Minute, 1000)
+	})
+	b.Run("30d-1m-2000px", func(b *testing.B) {
+		run(b, 30*24*time.Hour, time.Minute, 2000)
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/zeebo/rothko/data"
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/dist"
+	"github.com/zeebo/rothko/draw"
+	"github.com/zeebo/errs"
+)
+
+//
+// columns are merged on a bounded pool of goroutines while records are still
+// being pushed. each emitted column reserves the next slot in the results, so
+// the output order only depends on the order columns are emitted in. sending
+// a job blocks when every slot is busy, which keeps the number of records
+// waiting to be merged bounded. every job runs on its own goroutine that
+// exits once the job is merged, so nothing leaks if Finish is never called.
+//
+// the merges run with a context owned by the pool rather than one passed to
+// Push, because callers push from inside query callbacks whose contexts are
+// canceled once the query returns, before Finish is called.
+//
+
+// mergeJob is a column waiting to be merged by a worker.
+type mergeJob struct {
+	index      int
+	start, end int64
+	recs       []data.Record
+	weights    []float64
+	obs_sec    float64
+}
+
+// mergeResult is a merged column. If the Merger decays, only the distribution
+// is filled in, and otherwise only the column is.
+type mergeResult struct {
+	start, end int64
+	dist       dist.Dist
+	obs_sec    float64
+	col        draw.Column
+	err        error
+}
+
+// pool runs the workers merging columns for a Merger.
+type pool struct {
+	ctx    context.Context
+	cancel func()
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error
+	results []mergeResult
+}
+
+// workers returns the number of workers the options ask for.
+func (opts MergerOptions) workers() int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	return runtime.GOMAXPROCS(-1)
+}
+
+// submit queues up the job to be merged, waiting for a free worker if
+// necessary. It returns any error from a previously merged job.
+func (m *Merger) submit(ctx context.Context, job mergeJob) error {
+	p := &m.pool
+	if p.slots == nil {
+		p.ctx, p.cancel = context.WithCancel(context.Background())
+		p.slots = make(chan struct{}, m.opts.workers())
+	}
+
+	p.mu.Lock()
+	if err := p.err; err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	job.index = len(p.results)
+	p.results = append(p.results, mergeResult{})
+	p.mu.Unlock()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		err := errs.Wrap(ctx.Err())
+		p.mu.Lock()
+		p.results[job.index].err = err
+		p.mu.Unlock()
+		return err
+	}
+
+	p.wg.Add(1)
+	go m.worker(job)
+	return nil
+}
+
+// wait waits for every job to be merged and returns the results in the order
+// they were submitted, or the first error. If the context is done first, the
+// remaining merges are canceled.
+func (m *Merger) wait(ctx context.Context) ([]mergeResult, error) {
+	p := &m.pool
+	if p.slots != nil {
+		defer p.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			p.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			p.slots = nil
+		case <-ctx.Done():
+			return nil, errs.Wrap(ctx.Err())
+		}
+	}
+
+	for _, res := range p.results {
+		if res.err != nil {
+			return nil, res.err
+		}
+	}
+	results := p.results
+	p.results = nil
+	return results, nil
+}
+
+// worker merges the job, and frees up its slot.
+func (m *Merger) worker(job mergeJob) {
+	p := &m.pool
+	defer p.wg.Done()
+	defer func() { <-p.slots }()
+
+	res := m.merge(p.ctx, job)
+
+	p.mu.Lock()
+	p.results[job.index] = res
+	if res.err != nil && p.err == nil {
+		p.err = res.err
+		p.cancel()
+	}
+	p.mu.Unlock()
+}
+
+// merge merges the job into a column.
+func (m *Merger) merge(ctx context.Context, job mergeJob) (res mergeResult) {
+	res = mergeResult{start: job.start, end: job.end, obs_sec: job.obs_sec}
+
+	out, err := Merge(ctx, MergeOptions{
+		Params:  m.opts.Params,
+		Records: job.recs,
+		Weights: job.weights,
+	})
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+	res.dist, err = load.Load(ctx, out)
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+
+	// with decay, the column has to wait to be blended with the columns
+	// before it, which may not have been merged yet.
+	if m.opts.HalfLife <= 0 {
+		res.col = m.column(job.start, job.end, res.dist, job.obs_sec)
+		res.dist = nil
+	}
+
+	return res
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"math"
+
+	"github.com/zeebo/float16"
+)
+
+// Precision controls how the sampled values in a column are rounded. Rounding
+// keeps the encoded columns small, but can hide differences between values.
+type Precision int
+
+const (
+	// PrecisionHalf rounds values to a 16 bit float, which keeps about 3
+	// significant digits. It is the default.
+	PrecisionHalf Precision = iota
+
+	// PrecisionSingle rounds values to a 32 bit float.
+	PrecisionSingle
+
+	// PrecisionDouble keeps the values as they are.
+	PrecisionDouble
+
+	// PrecisionAuto picks the smallest precision for each column that does
+	// not round any distinct values in it to the same value.
+	PrecisionAuto
+)
+
+// ParsePrecision returns the Precision with the name returned by String.
+func ParsePrecision(name string) (Precision, error) {
+	for p := PrecisionHalf; p <= PrecisionAuto; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, Error.New("unknown precision: %q", name)
+}
+
+// String returns the name of the precision.
+func (p Precision) String() string {
+	switch p {
+	case PrecisionHalf:
+		return "half"
+	case PrecisionSingle:
+		return "single"
+	case PrecisionDouble:
+		return "double"
+	case PrecisionAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+// round rounds the sorted values in place.
+func (p Precision) round(vals []float64) {
+	var round func(float64) float64
+
+	switch p {
+	case PrecisionHalf:
+		round = roundHalf
+	case PrecisionSingle:
+		round = roundSingle
+	case PrecisionAuto:
+		for _, try := range []func(float64) float64{roundHalf, roundSingle} {
+			if !collapses(vals, try) {
+				round = try
+				break
+			}
+		}
+	}
+	if round == nil {
+		return
+	}
+
+	for i, val := range vals {
+		vals[i] = round(val)
+	}
+}
+
+// collapses returns true if any adjacent distinct sorted values are rounded
+// to the same value.
+func collapses(vals []float64, round func(float64) float64) bool {
+	for i := 1; i < len(vals); i++ {
+		if vals[i] != vals[i-1] && round(vals[i]) == round(vals[i-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// roundHalf rounds the value to a 16 bit float if it is in range.
+func roundHalf(val float64) float64 {
+	if val16, ok := float16.FromFloat64(val); ok {
+		return val16.Float64()
+	}
+	return val
+}
+
+// roundSingle rounds the value to a 32 bit float if it is in range.
+func roundSingle(val float64) float64 {
+	if val32 := float32(val); !math.IsInf(float64(val32), 0) {
+		return float64(val32)
+	}
+	return val
+}
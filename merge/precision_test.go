@@ -0,0 +1,58 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/zeebo/assert"
+)
+
+func TestPrecision(t *testing.T) {
+	round := func(p Precision, vals ...float64) []float64 {
+		out := append([]float64(nil), vals...)
+		p.round(out)
+		return out
+	}
+
+	t.Run("Parse", func(t *testing.T) {
+		for p := PrecisionHalf; p <= PrecisionAuto; p++ {
+			got, err := ParsePrecision(p.String())
+			assert.NoError(t, err)
+			assert.Equal(t, got, p)
+		}
+		_, err := ParsePrecision("quad")
+		assert.Error(t, err)
+	})
+
+	t.Run("Half", func(t *testing.T) {
+		vals := round(PrecisionHalf, 123456, 123457)
+		assert.Equal(t, vals[0], vals[1])
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		vals := round(PrecisionSingle, 123456, 123457, 1.1)
+		assert.DeepEqual(t, vals,
+			[]float64{123456, 123457, float64(float32(1.1))})
+	})
+
+	t.Run("Double", func(t *testing.T) {
+		vals := round(PrecisionDouble, 1.5e9+0.25, 1.5e9+0.5)
+		assert.DeepEqual(t, vals, []float64{1.5e9 + 0.25, 1.5e9 + 0.5})
+	})
+
+	t.Run("Auto", func(t *testing.T) {
+		// values that are far apart can be rounded to half precision.
+		assert.DeepEqual(t, round(PrecisionAuto, 1, 2, 3), []float64{1, 2, 3})
+		assert.DeepEqual(t, round(PrecisionAuto, 1, 2, 3),
+			round(PrecisionHalf, 1, 2, 3))
+
+		// values that differ in the 4th significant digit need single.
+		assert.DeepEqual(t, round(PrecisionAuto, 123456, 123457),
+			[]float64{123456, 123457})
+
+		// timestamps need double.
+		assert.DeepEqual(t, round(PrecisionAuto, 1.5e9+0.25, 1.5e9+0.5),
+			[]float64{1.5e9 + 0.25, 1.5e9 + 0.5})
+	})
+}
@@ -6,43 +6,48 @@ import (
 	"context"
 
 	"github.com/zeebo/rothko/data"
-	"github.com/zeebo/tdigest"
+	"github.com/zeebo/rothko/data/load"
+	"github.com/zeebo/rothko/dist"
 )
 
 //
-// a resampler is used to merge a bunch of unknown distribution kinds into a
-// single t-digest, since t-digest seems to be the best so far. hopefully
-// it will always be the case that we can support this operation with whatever
-// distributions we have in the future.
+// a resampler is used to merge a bunch of possibly different distribution
+// kinds into a single distribution of the output kind. records of the same
+// kind are merged directly if the distribution supports it, and records of
+// other kinds are resampled by quantiles weighted by their observations.
+// records that are only partially included are always resampled with the
+// scaled number of observations.
 //
 
-// TODO(jeff): this can probably use some refactoring to use the Dist
-// abstraction and data/dists/... packages. At the same time, these details
-// are going to be specific to the concrete distributions, so perhaps it's ok.
-
 type resampler struct {
-	dig *tdigest.TDigest
+	out dist.Dist
 }
 
-func newResampler(dig *tdigest.TDigest) *resampler {
+func newResampler(out dist.Dist) *resampler {
 	return &resampler{
-		dig: dig,
+		out: out,
 	}
 }
 
-func (res *resampler) Sample(ctx context.Context, r data.Record) error {
-	switch r.Kind {
-	case "tdigest":
-		other, err := tdigest.FromBytes(r.Distribution)
+func (res *resampler) Sample(ctx context.Context, r data.Record,
+	fraction float64) error {
+
+	if fraction < 1 {
+		count := scaleObservations(r.Observations, fraction)
+		if count <= 0 {
+			return nil
+		}
+		in, err := load.Load(ctx, r)
 		if err != nil {
-			return err
+			return Error.Wrap(err)
 		}
-		return res.dig.Merge(other)
+		return Error.Wrap(load.Resample(ctx, res.out, in, count))
 	}
 
-	return Error.New("unknown distribution kind: %v", r.Kind)
+	_, err := load.Into(ctx, res.out, r)
+	return Error.Wrap(err)
 }
 
 func (res *resampler) Finish(ctx context.Context) ([]byte, string, error) {
-	return res.dig.Marshal(nil), "tdigest", nil
+	return res.out.Marshal(nil), res.out.Kind(), nil
 }
@@ -0,0 +1,63 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import "math"
+
+// TailDepth is how close to 0 and 1 the quantiles returned by TailQuantiles
+// get before the endpoints.
+const TailDepth = 1e-3
+
+// UniformQuantiles returns samples + 1 evenly spaced quantiles from 0 to 1.
+func UniformQuantiles(samples int) []float64 {
+	if samples < 1 {
+		return []float64{0, 1}
+	}
+	out := make([]float64, 0, samples+1)
+	for i := 0; i <= samples; i++ {
+		out = append(out, float64(i)/float64(samples))
+	}
+	return out
+}
+
+// TailQuantiles returns samples + 1 quantiles from 0 to 1 that are more
+// dense near the tails. Other than 0 and 1, they are evenly spaced in log
+// odds between TailDepth and 1 - TailDepth. For example, with 30 samples, 11
+// of the quantiles are above 0.9 instead of 3 when evenly spaced.
+func TailQuantiles(samples int) []float64 {
+	if samples < 2 {
+		return UniformQuantiles(samples)
+	}
+
+	inner := samples - 1
+	limit := math.Log((1 - TailDepth) / TailDepth)
+
+	out := make([]float64, 0, samples+1)
+	out = append(out, 0)
+	for i := 0; i < inner; i++ {
+		t := 0.0
+		if inner > 1 {
+			t = -limit + 2*limit*float64(i)/float64(inner-1)
+		}
+		out = append(out, 1/(1+math.Exp(-t)))
+	}
+	out = append(out, 1)
+	return out
+}
+
+// CheckQuantiles returns an error if the quantiles are not increasing and in
+// [0, 1].
+func CheckQuantiles(quantiles []float64) error {
+	if len(quantiles) == 0 {
+		return Error.New("no quantiles")
+	}
+	for i, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return Error.New("quantile out of range: %v", q)
+		}
+		if i > 0 && q <= quantiles[i-1] {
+			return Error.New("quantiles not increasing: %v", quantiles)
+		}
+	}
+	return nil
+}
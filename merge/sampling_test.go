@@ -0,0 +1,68 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package merge
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/zeebo/assert"
+	"github.com/zeebo/rothko/data"
+)
+
+func TestQuantiles(t *testing.T) {
+	t.Run("Uniform", func(t *testing.T) {
+		assert.DeepEqual(t, UniformQuantiles(4),
+			[]float64{0, 0.25, 0.5, 0.75, 1})
+		assert.NoError(t, CheckQuantiles(UniformQuantiles(30)))
+	})
+
+	t.Run("Tail", func(t *testing.T) {
+		qs := TailQuantiles(30)
+		assert.Equal(t, len(qs), 31)
+		assert.NoError(t, CheckQuantiles(qs))
+		assert.Equal(t, qs[0], 0.0)
+		assert.Equal(t, qs[30], 1.0)
+		assert.That(t, math.Abs(qs[29]-(1-TailDepth)) < 1e-12)
+		assert.That(t, qs[15] == 0.5)
+
+		above := 0
+		for _, q := range qs {
+			if q > 0.9 {
+				above++
+			}
+		}
+		assert.Equal(t, above, 11)
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		assert.Error(t, CheckQuantiles(nil))
+		assert.Error(t, CheckQuantiles([]float64{0, 0.5, 0.5, 1}))
+		assert.Error(t, CheckQuantiles([]float64{-0.1, 1}))
+		assert.Error(t, CheckQuantiles([]float64{0, 1.1}))
+		assert.NoError(t, CheckQuantiles([]float64{0.5, 0.99, 0.999}))
+	})
+}
+
+func TestMergerQuantiles(t *testing.T) {
+	var recs []data.Record
+	for i := 100; i > 0; i-- {
+		recs = append(recs, newTestRecord(t, 0, time.Second, float64(i), 1))
+	}
+
+	quantiles := []float64{0, 0.5, 0.99, 1}
+	cols := runMerger(t, MergerOptions{
+		Now:       int64(time.Second),
+		Duration:  time.Second,
+		Params:    testParams,
+		Quantiles: quantiles,
+	}, 1, recs)
+
+	assert.Equal(t, len(cols), 1)
+	assert.DeepEqual(t, cols[0].Quantiles, quantiles)
+	assert.Equal(t, len(cols[0].Data), 4)
+	assert.Equal(t, cols[0].Data[0], 1.0)
+	assert.Equal(t, cols[0].Data[3], 100.0)
+	assert.That(t, cols[0].Data[2] > 95)
+}
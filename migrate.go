@@ -0,0 +1,89 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package rothko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/urfave/cli"
+	"github.com/zeebo/rothko/config"
+	"github.com/zeebo/rothko/database/files"
+	"github.com/zeebo/rothko/registry"
+	"github.com/zeebo/errs"
+)
+
+var migrateCommand = cli.Command{
+	Name:  "migrate",
+	Usage: "rewrite the files database with the latest record format",
+	ArgsUsage: t(`
+<path to rothko config>
+
+To generate a rothko config, see the init command.
+`),
+
+	Description: t(`
+The migrate command rewrites every file in the files database that contains
+records written in an older format. Older records can still be read, so this
+is not required, but it is needed to get the benefits of the newer format for
+data that has already been written. It should not be run while rothko is
+running.
+
+Files with problems are not rewritten. Repair them with the fsck command and
+then run migrate again.
+`),
+
+	Action: func(c *cli.Context) error {
+		if err := checkArgs(c, 1); err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(c.Args().Get(0))
+		if err != nil {
+			return errs.Wrap(err)
+		}
+
+		conf, err := config.Load(data)
+		if err != nil {
+			return err
+		}
+
+		return migrate(context.Background(), conf)
+	},
+}
+
+// migrate rewrites the files database defined by the config with the latest
+// record format.
+func migrate(ctx context.Context, conf *config.Config) (err error) {
+	db, err := registry.NewDatabase(ctx,
+		conf.Database.Kind, conf.Database.Config)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	fdb, ok := db.(*files.DB)
+	if !ok {
+		fmt.Printf("migrate only supports the files database, not %q\n",
+			conf.Database.Kind)
+		return handled.New("")
+	}
+
+	migrated, problems, err := fdb.Migrate(ctx)
+	for _, path := range migrated {
+		fmt.Println(path + ": migrated")
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("migrated %d file(s), skipped %d problem(s)\n",
+		len(migrated), len(problems))
+
+	if len(problems) > 0 {
+		return handled.New("")
+	}
+	return nil
+}